@@ -1,53 +1,251 @@
 package main
 
 import (
+  "bytes"
+  "context"
   "coriolis"
+  "coriolis/ghcnd"
   "coriolis/gsod"
   "encoding/json"
   "flag"
   "fmt"
+  "geo"
   "image"
+  "interp"
+  "io"
   "math"
   "os"
+  "os/signal"
   "path/filepath"
+  "projection"
+  "rule"
+  "runtime"
+  "stats"
+  "strconv"
+  "strings"
+  "time"
   "util"
 )
 
-// A temperature preference range.
+// A temperature preference range along with the other thresholds that
+// make a day pleasant. These are loaded from a preferences file and each
+// produces its own <Name>.json.
 type TempPref struct {
   AvgMin float64
   AvgMax float64
   AbsMin float64
   AbsMax float64
   Name   string
-}
 
-var (
-  // the normal temperature range
-  LikeItNorm = &TempPref{55, 75, 45, 85, "norm"}
+  // The most precipitation (inches) and snow depth (inches) allowed.
+  MaxPrecip    float64
+  MaxSnowDepth float64
+
+  // The highest mean and maximum sustained wind speed (knots) allowed. A zero
+  // value imposes no limit.
+  MaxWindAvg float64
+  MaxWindMax float64
+
+  // Compare apparent temperatures (heat index & wind chill) rather than the
+  // dry-bulb temperatures against the ranges above.
+  Apparent bool
+
+  // Treat max/min temperatures derived from hourly data as missing.
+  IgnoreDerivedTemps bool
+
+  // Treat precipitation totals covering less than a full day as missing.
+  IgnorePartialPrecip bool
+
+  // Treat values that failed a quality check, which are only kept with
+  // -keep-suspect, as missing. Days left without a temperature are skipped.
+  IgnoreSuspect bool
 
-  // for those that like it a little warmer
-  LikeItWarm = &TempPref{65, 85, 55, 95, "warm"}
+  // An optional rule (see package rule) that decides whether a day is
+  // pleasant. When given, it is used instead of all of the thresholds above.
+  Rule string
 
-  // for those that like it a little cooler
-  LikeItCool = &TempPref{45, 65, 35, 65, "cool"}
+  // How days are scored. ScoreCount (the default) only counts the pleasant
+  // days, ScoreComfort also grades each day from 0 to 1 and reports the mean
+  // comfort of each month.
+  Score string
+
+  // For comfort scoring, the number of degrees beyond the preferred range at
+  // which comfort falls to zero and the fraction of comfort lost on a day
+  // with precipitation or high wind.
+  ComfortFalloff float64
+  RainPenalty    float64
+  WindPenalty    float64
+
+  // The maximum sustained wind speed (knots) above which a day is windy for
+  // comfort scoring. Unlike MaxWindMax, this is set by default.
+  WindyAbove float64
+
+  compiled *rule.Rule
+}
+
+const (
+  ScoreCount   = "count"
+  ScoreComfort = "comfort"
 )
 
-// All known temperature preferences
-var TempPrefs = []*TempPref{
-  // LikeItCool,
-  LikeItNorm,
-  // LikeItWarm,
+// The values used for anything a preferences file does not specify.
+var DefaultTempPref = TempPref{
+  AvgMin:         55,
+  AvgMax:         75,
+  AbsMin:         45,
+  AbsMax:         85,
+  MaxPrecip:      0,
+  MaxSnowDepth:   0.25,
+  Score:          ScoreCount,
+  ComfortFalloff: 15,
+  RainPenalty:    0.5,
+  WindPenalty:    0.25,
+  WindyAbove:     20,
+}
+
+// Load the temperature preferences from a file, which holds a JSON array of
+// TempPref objects. Fields omitted from an object take their value from
+// DefaultTempPref. Unknown fields are an error.
+func LoadTempPrefs(filename string) ([]*TempPref, error) {
+  r, err := os.Open(filename)
+  if err != nil {
+    return nil, err
+  }
+  defer r.Close()
+
+  var raw []json.RawMessage
+  if err := json.NewDecoder(r).Decode(&raw); err != nil {
+    return nil, err
+  }
+
+  names := map[string]bool{}
+  prefs := make([]*TempPref, 0, len(raw))
+  for i, msg := range raw {
+    // a misspelled key would otherwise quietly leave its default in place.
+    p := DefaultTempPref
+    d := json.NewDecoder(bytes.NewReader(msg))
+    d.DisallowUnknownFields()
+    if err := d.Decode(&p); err != nil {
+      return nil, fmt.Errorf("%s: preference %d: %s", filename, i, err)
+    }
+
+    if p.Name == "" {
+      return nil, fmt.Errorf("%s: preference %d has no name", filename, i)
+    }
+
+    if names[p.Name] {
+      return nil, fmt.Errorf("%s: duplicate preference %s", filename, p.Name)
+    }
+    names[p.Name] = true
+
+    if p.Score != ScoreCount && p.Score != ScoreComfort {
+      return nil, fmt.Errorf("%s: %s: unknown score %q", filename, p.Name, p.Score)
+    }
+
+    if p.Score == ScoreComfort && p.ComfortFalloff <= 0 {
+      return nil, fmt.Errorf("%s: %s: ComfortFalloff must be positive", filename, p.Name)
+    }
+
+    if p.Rule != "" {
+      r, err := rule.Parse(p.Rule)
+      if err != nil {
+        return nil, fmt.Errorf("%s: %s: %s", filename, p.Name, err)
+      }
+      p.compiled = r
+    }
+
+    prefs = append(prefs, &p)
+  }
+
+  return prefs, nil
 }
 
-// Declares a grid of certain width & height with a list of
-// active cells. This is used to selectively turn off parts
-// of the grid.
-type GridConfig struct {
-  W      int
-  H      int
-  Size   int
-  Active [][]int
+// The extent of the rectangle of lat, lon on the plane. The edges are
+// sampled since they may not be straight under the projection.
+func projectedBounds(min, max geo.Point, p projection.Projection) (float64, float64, float64, float64) {
+  minX, minY := math.Inf(1), math.Inf(1)
+  maxX, maxY := math.Inf(-1), math.Inf(-1)
+  add := func(lat, lon float64) {
+    x, y := p.Forward(lat, lon)
+    minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+    minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+  }
+
+  const n = 100
+  for i := 0; i <= n; i++ {
+    f := float64(i) / n
+    lat, lon := min.Lat+(max.Lat-min.Lat)*f, min.Lon+(max.Lon-min.Lon)*f
+    add(lat, min.Lon)
+    add(lat, max.Lon)
+    add(min.Lat, lon)
+    add(max.Lat, lon)
+  }
+
+  return minX, minY, maxX, maxY
+}
+
+// Lay out a geographically defined grid, filling in W, H and Active, and
+// return the transformation from lat, lon to virtual coordinates.
+func LayoutGrid(c *geo.GridConfig, dir string, stations []*coriolis.Station, p projection.Projection) (*projection.Transform, error) {
+  if c.Size == 0 {
+    c.Size = 10
+  }
+
+  // the cell size in meters
+  cell := c.CellKm * 1000
+  if c.CellDeg > 0 {
+    cell = c.CellDeg * projection.EarthRadius * math.Pi / 180
+  }
+
+  var polys []geo.Polygon
+  if c.Boundary != "" {
+    var err error
+    polys, err = geo.LoadBoundary(filepath.Join(dir, c.Boundary))
+    if err != nil {
+      return nil, err
+    }
+  }
+
+  var min, max geo.Point
+  switch {
+  case len(c.Bounds) == 4:
+    min = geo.Point{Lat: c.Bounds[0], Lon: c.Bounds[1]}
+    max = geo.Point{Lat: c.Bounds[2], Lon: c.Bounds[3]}
+  case len(c.Bounds) != 0:
+    return nil, fmt.Errorf("grid bounds must be [min lat, min lon, max lat, max lon]")
+  case len(polys) > 0:
+    min, max = geo.Bounds(polys)
+  default:
+    min = geo.Point{Lat: math.Inf(1), Lon: math.Inf(1)}
+    max = geo.Point{Lat: math.Inf(-1), Lon: math.Inf(-1)}
+    for _, s := range stations {
+      min.Lat, max.Lat = math.Min(min.Lat, s.Lat), math.Max(max.Lat, s.Lat)
+      min.Lon, max.Lon = math.Min(min.Lon, s.Lon), math.Max(max.Lon, s.Lon)
+    }
+  }
+
+  minX, minY, maxX, maxY := projectedBounds(min, max, p)
+  c.W = int(math.Ceil((maxX - minX) / cell))
+  c.H = int(math.Ceil((maxY - minY) / cell))
+
+  // the zip index packs I and J into 8 bits each.
+  if c.W > 256 || c.H > 256 {
+    return nil, fmt.Errorf("grid of %dx%d cells is too large, it can be at most 256x256", c.W, c.H)
+  }
+
+  tx := projection.NewTransform(p, minX, maxY, float64(c.Size)/cell)
+
+  if len(polys) > 0 {
+    c.Active = geo.ActiveCells(polys, tx.Forward, float64(c.Size), c.W, c.H)
+  } else if len(c.Active) == 0 {
+    for i := 0; i < c.W; i++ {
+      for j := 0; j < c.H; j++ {
+        c.Active = append(c.Active, []int{i, j})
+      }
+    }
+  }
+
+  return tx, nil
 }
 
 // The location of a station in virtual coordinates
@@ -68,6 +266,26 @@ type Region struct {
   Nearest  []*StationLoc
   Zips     []*Zip
   City     string
+
+  // The geographic location of the center of the region.
+  Lat float64
+  Lon float64
+
+  // The representative elevation of the region in meters.
+  Elev    float64
+  HasElev bool
+
+  // The nearest stations that were operating in each of the years of the
+  // Neighbors used to build the grid, if any.
+  NearestIn [][]*StationLoc
+}
+
+// The nearest stations to use for the y-th year.
+func (r *Region) NearestFor(y int) []*StationLoc {
+  if r.NearestIn == nil {
+    return r.Nearest
+  }
+  return r.NearestIn[y]
 }
 
 // Essentially a matrix of regions. Inactive regions
@@ -78,63 +296,6 @@ type Grid struct {
   Grid [][]*Region
 }
 
-// Simple euclidean distance.
-func Distance(x0, y0, x1, y1 float64) float64 {
-  dx, dy := x1-x0, y1-y0
-  return math.Sqrt(dx*dx + dy*dy)
-}
-
-// Sort a list of station locations by their distance to a particular point.
-func SortStationLocs(locs []*StationLoc, x, y float64) {
-  dist := make([]float64, len(locs))
-  for i, loc := range locs {
-    dist[i] = Distance(loc.X, loc.Y, x, y)
-  }
-
-  util.Sort(len(locs),
-    func(i, j int) bool {
-      return dist[i] < dist[j]
-    },
-    func(i, j int) {
-      locs[i], locs[j] = locs[j], locs[i]
-      dist[i], dist[j] = dist[j], dist[i]
-    })
-}
-
-// Find the stations nearest the region (i,j) searching in radius r.
-func (g *Grid) StationsAround(locs *[]*StationLoc, i, j, r int) {
-  if i < 0 || j < 0 {
-    return
-  }
-
-  if i >= g.W || j >= g.H {
-    return
-  }
-
-  reg := g.Grid[i][j]
-  if r == 0 {
-    if reg != nil {
-      for _, loc := range reg.Stations {
-        *locs = append(*locs, loc)
-      }
-    }
-    return
-  }
-
-  // top & bottom row
-  for k := -r; k <= r; k++ {
-    g.StationsAround(locs, i+k, j-r, 0)
-    g.StationsAround(locs, i+k, j+r, 0)
-  }
-
-  n := r - 1
-  // left & right cols
-  for k := -n; k <= n; k++ {
-    g.StationsAround(locs, i-r, j+k, 0)
-    g.StationsAround(locs, i+r, j+k, 0)
-  }
-}
-
 // Locate the major (most populous) city with region (i,j). This returns
 // the name of the city and the population. If (i,j) is an inactive region,
 // this will simply return "" and 0.
@@ -252,61 +413,145 @@ func LabelFor(g *Grid, i, j int) string {
   return names[0]
 }
 
-// Find the nearest N stations to the region r. This will search in an increasing
-// radius in and around a region until N stations are found.
-func NearestN(c *GridConfig, grid *Grid, r *Region, n int) []*StationLoc {
-  cx := float64(r.Rect.Min.X) + float64(r.Rect.Dx())/2.0
-  cy := float64(r.Rect.Min.Y) + float64(r.Rect.Dy())/2.0
+// Describes how the stations nearest each region are chosen.
+type Neighbors struct {
+  // The number of stations to choose.
+  N int
 
-  var locs []*StationLoc
-  rad := 0
-  for len(locs) < n {
-    grid.StationsAround(&locs, r.I, r.J, rad)
-    rad++
-  }
+  // The distance in meters beyond which stations are not chosen, 0 for no limit.
+  MaxDist float64
 
-  SortStationLocs(locs, cx, cy)
+  // Stations whose elevation differs from the region's by more than ElevLimit
+  // meters are not chosen, 0 for no limit.
+  ElevLimit float64
 
-  return locs[0:n]
+  // Each meter of elevation difference counts as ElevWeight meters of distance
+  // when ranking stations.
+  ElevWeight float64
+
+  // If not empty, stations are also chosen for each of these years from those
+  // that were operating.
+  Years []int
 }
 
-// Load the grid config from a file.
-func LoadGridConfig(filename string, c *GridConfig) error {
-  r, err := os.Open(filename)
-  if err != nil {
-    return err
+// The elevation difference between a station and a region, which is zero if either
+// is unknown.
+func elevDiff(r *Region, s *coriolis.Station) float64 {
+  if !r.HasElev || !s.HasElev {
+    return 0
   }
-  defer r.Close()
+  return math.Abs(r.Elev - s.Elev)
+}
 
-  if err := json.NewDecoder(r).Decode(c); err != nil {
-    return err
+// The representative elevation of a region is the median elevation of the stations
+// within it or, for regions without any, that of the nearest station.
+func regionElev(store *coriolis.Store, r *Region) (float64, bool) {
+  var elevs []float64
+  for _, loc := range r.Stations {
+    if loc.HasElev {
+      elevs = append(elevs, loc.Elev)
+    }
   }
 
-  return nil
+  if len(elevs) == 0 {
+    s := store.NearestMatching(r.Lat, r.Lon, 1, 0, func(s *coriolis.Station) bool {
+      return s.HasElev
+    })
+    if len(s) == 0 {
+      return 0, false
+    }
+    return s[0].Elev, true
+  }
+
+  util.Sort(len(elevs),
+    func(i, j int) bool {
+      return elevs[i] < elevs[j]
+    },
+    func(i, j int) {
+      elevs[i], elevs[j] = elevs[j], elevs[i]
+    })
+
+  n := len(elevs)
+  if n%2 == 0 {
+    return (elevs[n/2-1] + elevs[n/2]) / 2, true
+  }
+  return elevs[n/2], true
 }
 
-// Compute a transformation function that will take a point in lat, lon and produce a virtual x, y that fits relatively
-// in the Rectangle r. TODO(knorton): This is a stupid and lazy projection, but it works.
-func ComputeTransform(stations []*coriolis.Station, r image.Rectangle) func(float64, float64) (float64, float64) {
-  minY, maxY, minX, maxX := stations[0].Lat, stations[0].Lat, stations[0].Lon, stations[0].Lon
-  for _, s := range stations {
-    if s.Lat > maxY {
-      maxY = s.Lat
-    } else if s.Lat < minY {
-      minY = s.Lat
-    } else if s.Lon > maxX {
-      maxX = s.Lon
-    } else if s.Lon < minX {
-      minX = s.Lon
+// Find the nearest stations (by great-circle distance) to the center of the region r
+// as described by nb. Only stations that were operating in year are chosen, unless
+// year is 0.
+func NearestN(store *coriolis.Store, locs map[*coriolis.Station]*StationLoc, r *Region, nb *Neighbors, year int) []*StationLoc {
+  if nb.N <= 0 {
+    return nil
+  }
+
+  fn := func(s *coriolis.Station) bool {
+    if locs[s] == nil {
+      return false
+    }
+    if nb.ElevLimit > 0 && elevDiff(r, s) > nb.ElevLimit {
+      return false
     }
+    return year == 0 || s.ActiveIn(year)
   }
 
-  f := float64(r.Dx()) / (maxX - minX)
-  return func(lat, lon float64) (float64, float64) {
-    return (lon - minX) * f, (maxY - lat) * f
+  if nb.ElevWeight <= 0 {
+    var nearest []*StationLoc
+    for _, s := range store.NearestMatching(r.Lat, r.Lon, nb.N, nb.MaxDist, fn) {
+      nearest = append(nearest, locs[s])
+    }
+    return nearest
+  }
+
+  // The penalty never makes a station any closer, so keep widening the search until
+  // the farthest candidate is beyond the N-th best penalized distance.
+  for k := 2 * nb.N; ; k *= 2 {
+    stations := store.NearestMatching(r.Lat, r.Lon, k, nb.MaxDist, fn)
+    dist := make([]float64, len(stations))
+    for i, s := range stations {
+      dist[i] = coriolis.Distance(r.Lat, r.Lon, s.Lat, s.Lon)
+    }
+    farthest := 0.0
+    if len(dist) > 0 {
+      farthest = dist[len(dist)-1]
+    }
+
+    for i, s := range stations {
+      dist[i] += nb.ElevWeight * elevDiff(r, s)
+    }
+
+    util.Sort(len(stations),
+      func(i, j int) bool {
+        return dist[i] < dist[j]
+      },
+      func(i, j int) {
+        stations[i], stations[j] = stations[j], stations[i]
+        dist[i], dist[j] = dist[j], dist[i]
+      })
+
+    if len(stations) < k || dist[nb.N-1] <= farthest {
+      if len(stations) > nb.N {
+        stations = stations[:nb.N]
+      }
+
+      nearest := make([]*StationLoc, len(stations))
+      for i, s := range stations {
+        nearest[i] = locs[s]
+      }
+      return nearest
+    }
   }
 }
 
+// Compute a transformation function that will take a point in lat, lon and produce a virtual x, y that fits relatively
+// in the Rectangle r using the given projection.
+func ComputeTransform(stations []*coriolis.Station, r image.Rectangle, p projection.Projection) *projection.Transform {
+  return projection.Fit(p, float64(r.Dx()), len(stations), func(i int) (float64, float64) {
+    return stations[i].Lat, stations[i].Lon
+  })
+}
+
 // Use the transformation to place each of the stations into a location.
 func PlaceStations(stations []*coriolis.Station, tx func(float64, float64) (float64, float64)) []*StationLoc {
   var locs []*StationLoc
@@ -321,8 +566,10 @@ func PlaceStations(stations []*coriolis.Station, tx func(float64, float64) (floa
   return locs
 }
 
-// Take the list of station locations and fold them into the regions of a grid.
-func BuildGrid(locs []*StationLoc, zips []*Zip, r image.Rectangle, c *GridConfig) *Grid {
+// Take the list of station locations and fold them into the regions of a grid. inv
+// maps virtual coordinates back to lat, lon. Each region is given the stations in
+// store nearest to it as described by nb.
+func BuildGrid(store *coriolis.Store, locs []*StationLoc, zips []*Zip, r image.Rectangle, c *geo.GridConfig, inv func(float64, float64) (float64, float64), nb *Neighbors) *Grid {
   nx, ny := c.W, c.H
   regs := make([][]*Region, nx)
   for i := 0; i < nx; i++ {
@@ -332,16 +579,21 @@ func BuildGrid(locs []*StationLoc, zips []*Zip, r image.Rectangle, c *GridConfig
   // create all active rectangles
   for _, xy := range c.Active {
     i, j := xy[0], xy[1]
-    regs[i][j] = &Region{
+    reg := &Region{
       I:    i,
       J:    j,
       Rect: image.Rect(i*c.Size, j*c.Size, (i+1)*c.Size, (j+1)*c.Size),
     }
+    reg.Lat, reg.Lon = inv((float64(i)+0.5)*float64(c.Size), (float64(j)+0.5)*float64(c.Size))
+    regs[i][j] = reg
   }
 
   // assign stations to their region
   for _, loc := range locs {
     ix, iy := int(loc.X/float64(c.Size)), int(loc.Y/float64(c.Size))
+    if loc.X < 0 || ix >= c.W || loc.Y < 0 || iy >= c.H {
+      continue
+    }
     r := regs[ix][iy]
     if r == nil {
       continue
@@ -368,9 +620,22 @@ func BuildGrid(locs []*StationLoc, zips []*Zip, r image.Rectangle, c *GridConfig
     Grid: regs,
   }
 
+  index := map[*coriolis.Station]*StationLoc{}
+  for _, loc := range locs {
+    index[loc.Station] = loc
+  }
+
   for _, xy := range c.Active {
     i, j := xy[0], xy[1]
-    regs[i][j].Nearest = NearestN(c, grid, regs[i][j], 20)
+    reg := regs[i][j]
+    reg.Elev, reg.HasElev = regionElev(store, reg)
+    reg.Nearest = NearestN(store, index, reg, nb, 0)
+    if len(nb.Years) > 0 {
+      reg.NearestIn = make([][]*StationLoc, len(nb.Years))
+      for k, year := range nb.Years {
+        reg.NearestIn[k] = NearestN(store, index, reg, nb, year)
+      }
+    }
     city := LabelFor(grid, i, j)
     regs[i][j].City = city
   }
@@ -378,48 +643,115 @@ func BuildGrid(locs []*StationLoc, zips []*Zip, r image.Rectangle, c *GridConfig
   return grid
 }
 
-// Utility method for serializing an object to JSON and writing
-// it to a file.
-func WriteJson(filename string, data interface{}) error {
-  w, err := os.Create(filename)
-  if err != nil {
-    return err
+// The mean, max & min temperature of the day as they will be compared against
+// the temperature prefs.
+func tempsOf(s *coriolis.Summary, p *TempPref) (float64, float64, float64) {
+  if p.Apparent {
+    return s.ApparentTemp(s.TempAvg), s.ApparentTemp(s.TempMax), s.ApparentTemp(s.TempMin)
   }
-  defer w.Close()
+  return s.TempAvg, s.TempMax, s.TempMin
+}
 
-  return json.NewEncoder(w).Encode(data)
+// Whether the max & min temperatures and the precipitation of the day are
+// present and should be taken into account according to the prefs.
+func fieldsOf(s *coriolis.Summary, p *TempPref) (bool, bool, bool) {
+  return s.Has(coriolis.FieldTempMax) && !(p.IgnoreDerivedTemps && s.TempMaxDerived),
+    s.Has(coriolis.FieldTempMin) && !(p.IgnoreDerivedTemps && s.TempMinDerived),
+    s.Has(coriolis.FieldPrecip) && !(p.IgnorePartialPrecip && !s.PrecipComplete())
 }
 
 // Determine if the summary data indicates a "pleasant" day according to the
 // given temperature prefs.
-func IsPleasant(s *gsod.Summary, p *TempPref) bool {
-  if s.TempAvg < 999 && (s.TempAvg < p.AvgMin || s.TempAvg > p.AvgMax) {
+func IsPleasant(s *coriolis.Summary, p *TempPref) bool {
+  if p.compiled != nil {
+    return p.compiled.Eval(s)
+  }
+
+  avg, max, min := tempsOf(s, p)
+
+  if s.Has(coriolis.FieldTempAvg) && (avg < p.AvgMin || avg > p.AvgMax) {
+    return false
+  }
+
+  hasMax, hasMin, hasPrecip := fieldsOf(s, p)
+  if hasMax && max > p.AbsMax {
+    return false
+  }
+
+  if hasMin && min < p.AbsMin {
     return false
   }
 
-  if s.TempMax < 999 && s.TempMax > p.AbsMax {
+  if hasPrecip && s.Precip > p.MaxPrecip {
     return false
   }
 
-  if s.TempMin < p.AbsMin {
+  if s.Has(coriolis.FieldSnowDepth) && s.SnowDepth > p.MaxSnowDepth {
     return false
   }
 
-  if s.Precip < 99 && s.Precip > 0.000001 {
+  if p.MaxWindAvg > 0 && s.Has(coriolis.FieldWindAvg) && s.WindAvg > p.MaxWindAvg {
     return false
   }
 
-  if s.SnowDepth < 999 && s.SnowDepth > 0.25 {
+  if p.MaxWindMax > 0 && s.Has(coriolis.FieldWindMax) && s.WindMax > p.MaxWindMax {
     return false
   }
 
   return true
 }
 
+// Scale x, a number of degrees beyond the preferred range, to a comfort
+// between 0 and 1.
+func falloff(x, f float64) float64 {
+  if x <= 0 {
+    return 1
+  }
+  if x >= f {
+    return 0
+  }
+  return 1 - x/f
+}
+
+// Grade the day from 0 (miserable) to 1 (perfectly pleasant) according to
+// how far it strays from the given temperature prefs, with penalties for
+// precipitation and high wind. Days without a mean temperature cannot be
+// graded and return false.
+func ComfortOf(s *coriolis.Summary, p *TempPref) (float64, bool) {
+  if !s.Has(coriolis.FieldTempAvg) {
+    return 0, false
+  }
+
+  avg, max, min := tempsOf(s, p)
+
+  c := falloff(math.Max(p.AvgMin-avg, avg-p.AvgMax), p.ComfortFalloff)
+
+  hasMax, hasMin, hasPrecip := fieldsOf(s, p)
+  if hasMax {
+    c *= falloff(max-p.AbsMax, p.ComfortFalloff)
+  }
+
+  if hasMin {
+    c *= falloff(p.AbsMin-min, p.ComfortFalloff)
+  }
+
+  if hasPrecip && s.Precip > p.MaxPrecip {
+    c *= 1 - p.RainPenalty
+  }
+
+  if s.Has(coriolis.FieldWindMax) && s.WindMax > p.WindyAbove {
+    c *= 1 - p.WindPenalty
+  }
+
+  return c, true
+}
+
 // A rational type holding a perctage value, that can also
-// represent NaN as zero.
+// represent NaN as zero. A & B are counts of days (or the sum
+// of comfort and the count of days) or, when interpolating,
+// weighted sums of fractions and weights.
 type Pct struct {
-  A, B int
+  A, B float64
 }
 
 // Turn the number into a byte (0-255), 0 is the null value.
@@ -427,10 +759,13 @@ func (p *Pct) Byte() byte {
   if p.B == 0 {
     return 0
   }
-  f := 255.0 * float64(p.A) / float64(p.B)
+  f := 255.0 * p.A / p.B
   if f >= 255 {
     return 255
   }
+  if f < 0 {
+    return 1
+  }
   return 1 + byte(f)
 }
 
@@ -439,17 +774,26 @@ type RegionStats struct {
   *Region
   Months [12]byte
   Total  byte
+
+  // The mean comfort of each month, only for comfort scoring.
+  Comfort      *[12]byte
+  ComfortTotal byte
+
+  // The pleasant days of each month for each of the store's years.
+  Years [][12]Pct
 }
 
 // A customized JSON marshaler.
 func (r *RegionStats) MarshalJSON() ([]byte, error) {
   var d struct {
-    I        int
-    J        int
-    Stations []string
-    City     string
-    Months   [12]byte
-    Total    byte
+    I            int
+    J            int
+    Stations     []string
+    City         string
+    Months       [12]byte
+    Total        byte
+    Comfort      *[12]byte `json:",omitempty"`
+    ComfortTotal byte      `json:",omitempty"`
   }
 
   d.I = r.I
@@ -458,8 +802,21 @@ func (r *RegionStats) MarshalJSON() ([]byte, error) {
 
   d.Months = r.Months
   d.Total = r.Total
-  for _, station := range r.Nearest {
-    d.Stations = append(d.Stations, station.Id())
+  d.Comfort = r.Comfort
+  d.ComfortTotal = r.ComfortTotal
+  seen := map[string]bool{}
+  for y := -1; y < len(r.NearestIn); y++ {
+    nearest := r.Nearest
+    if y >= 0 {
+      nearest = r.NearestIn[y]
+    }
+
+    for _, station := range nearest {
+      if id := station.Id(); !seen[id] {
+        seen[id] = true
+        d.Stations = append(d.Stations, id)
+      }
+    }
   }
 
   return json.Marshal(&d)
@@ -482,6 +839,20 @@ func toRegionStats(region *Region, data [12]Pct) *RegionStats {
   }
 }
 
+// Add the mean comfort of each month to the RegionStats.
+func (r *RegionStats) setComfort(data [12]Pct) {
+  var c [12]byte
+  var m Pct
+  for i := 0; i < 12; i++ {
+    c[i] = data[i].Byte()
+    m.A += data[i].A
+    m.B += data[i].B
+  }
+
+  r.Comfort = &c
+  r.ComfortTotal = m.Byte()
+}
+
 // Provides constant time lookup of RegionStats by (i,j)
 type RegionStatsMap map[int]*RegionStats
 
@@ -500,27 +871,127 @@ func (r RegionStatsMap) Get(i, j int) *RegionStats {
   return r[i<<16|j]
 }
 
+// Combine the data for the stations nearest a region into the region's data for
+// each of n years. Without an interpolator, the counts of days are simply summed.
+// Otherwise, each month is the weighted mean of the pleasant fraction (or the
+// mean comfort) at each station that has data for that month. The weights
+// depend only on which stations have data, so they are cached by that set in
+// cache, which may be shared between calls for the same region.
+func regionSeries(r *Region, m map[string][][12]Pct, n int, ip interp.Interpolator, cache map[string][]float64) ([][12]Pct, error) {
+  series := make([][12]Pct, n)
+  if ip == nil {
+    for y := 0; y < n; y++ {
+      for _, station := range r.NearestFor(y) {
+        s := m[station.Id()]
+        for k := 0; k < 12; k++ {
+          series[y][k].A += s[y][k].A
+          series[y][k].B += s[y][k].B
+        }
+      }
+    }
+    return series, nil
+  }
+
+  var locs []*StationLoc
+  var ids []string
+  for y := 0; y < n; y++ {
+    for k := 0; k < 12; k++ {
+      locs, ids = locs[:0], ids[:0]
+      for _, station := range r.NearestFor(y) {
+        if m[station.Id()][y][k].B > 0 {
+          locs = append(locs, station)
+          ids = append(ids, station.Id())
+        }
+      }
+
+      if len(locs) == 0 {
+        continue
+      }
+
+      key := strings.Join(ids, ",")
+      w, ok := cache[key]
+      if !ok {
+        var err error
+        w, err = ip.Weights(len(locs),
+          func(i int) float64 {
+            return coriolis.Distance(r.Lat, r.Lon, locs[i].Lat, locs[i].Lon)
+          },
+          func(i, j int) float64 {
+            return locs[i].DistanceTo(locs[j].Station)
+          })
+        if err != nil {
+          return nil, fmt.Errorf("region (%d,%d): %s", r.I, r.J, err)
+        }
+        cache[key] = w
+      }
+
+      p := &series[y][k]
+      for i := range locs {
+        s := &m[ids[i]][y][k]
+        p.A += w[i] * s.A / s.B
+        p.B += w[i]
+      }
+    }
+  }
+
+  return series, nil
+}
+
 // Most of the work will be done here as this computes that data for and writes the
 // stats files for each region.
-func WriteStatsFiles(dir string, store *gsod.Store, grid *Grid, tp *TempPref) error {
+func WriteStatsFiles(ctx context.Context, dir string, src coriolis.Source, grid *Grid, tp *TempPref, jobs int, ip interp.Interpolator) error {
+  comfort := tp.Score == ScoreComfort
+  store, years := src.StationStore(), src.YearRange()
+
   m := map[string][][12]Pct{}
+  c := map[string][][12]Pct{}
   for _, station := range store.Stations {
-    m[station.Id()] = make([][12]Pct, len(store.Years))
+    m[station.Id()] = make([][12]Pct, len(years))
+    if comfort {
+      c[station.Id()] = make([][12]Pct, len(years))
+    }
   }
 
-  for i, year := range store.Years {
-    fmt.Printf("%d\n", year)
-    if err := store.ForEachSummaryInYear(year, func(s *gsod.Summary) error {
-      month := s.Day.Month() - 1
-      p := &m[s.Station.Id()][i][month]
-      if IsPleasant(s, tp) {
-        p.A++
-      }
-      p.B++
-      return nil
-    }); err != nil {
-      return err
-    }
+  // each year is read by its own job and only touches its own slot in m, so
+  // the result does not depend on the order in which the jobs complete.
+  w := util.StartWorkerWithContext(ctx, jobs)
+  for i, year := range years {
+    i, year := i, year
+    w.Do(func() error {
+      fmt.Printf("%d\n", year)
+      return src.ForEachSummaryInYear(year, func(s *coriolis.Summary) error {
+        if err := w.Context().Err(); err != nil {
+          return err
+        }
+
+        if tp.IgnoreSuspect && s.Suspect != 0 {
+          s.Valid &^= s.Suspect
+          if s.Valid&(coriolis.FieldTempAvg|coriolis.FieldTempMax|coriolis.FieldTempMin) == 0 {
+            return nil
+          }
+        }
+
+        month := s.Day.Month() - 1
+        p := &m[s.Station.Id()][i][month]
+        if IsPleasant(s, tp) {
+          p.A++
+        }
+        p.B++
+
+        if comfort {
+          if v, ok := ComfortOf(s, tp); ok {
+            cp := &c[s.Station.Id()][i][month]
+            cp.A += v
+            cp.B++
+          }
+        }
+        return nil
+      })
+    })
+  }
+
+  if err := w.WaitForExit(); err != nil {
+    return err
   }
 
   rm := NewRegionStatsMap()
@@ -533,22 +1004,41 @@ func WriteStatsFiles(dir string, store *gsod.Store, grid *Grid, tp *TempPref) er
         continue
       }
 
+      cache := map[string][]float64{}
+      series, err := regionSeries(r, m, len(years), ip, cache)
+      if err != nil {
+        return err
+      }
+
       var allYears [12]Pct
-      for y := 0; y < len(store.Years); y++ {
-        var thisYear [12]Pct
-        for _, station := range r.Nearest {
-          s := m[station.Id()]
-          for m := 0; m < 12; m++ {
-            thisYear[m].A += s[y][m].A
-            thisYear[m].B += s[y][m].B
+      for _, thisYear := range series {
+        for m := 0; m < 12; m++ {
+          allYears[m].A += thisYear[m].A
+          allYears[m].B += thisYear[m].B
+        }
+      }
 
-            allYears[m].A += s[y][m].A
-            allYears[m].B += s[y][m].B
+      // comfort is combined across stations just as the pleasant days are.
+      var allComfort [12]Pct
+      if comfort {
+        cs, err := regionSeries(r, c, len(years), ip, cache)
+        if err != nil {
+          return err
+        }
+
+        for _, thisYear := range cs {
+          for m := 0; m < 12; m++ {
+            allComfort[m].A += thisYear[m].A
+            allComfort[m].B += thisYear[m].B
           }
         }
       }
 
       rs := toRegionStats(r, allYears)
+      rs.Years = series
+      if comfort {
+        rs.setComfort(allComfort)
+      }
       rm.Put(rs)
       overall = append(overall, rs)
     }
@@ -573,7 +1063,208 @@ func WriteStatsFiles(dir string, store *gsod.Store, grid *Grid, tp *TempPref) er
   s.H = grid.H
   s.Regions = overall
 
-  return WriteJson(filepath.Join(dir, fmt.Sprintf("%s.json", tp.Name)), &s)
+  if err := util.WriteJson(filepath.Join(dir, fmt.Sprintf("%s.json", tp.Name)), &s); err != nil {
+    return err
+  }
+
+  if err := WriteYearsFile(filepath.Join(dir, "years", fmt.Sprintf("%s.json", tp.Name)), years, overall); err != nil {
+    return err
+  }
+
+  return WriteTrendsFile(filepath.Join(dir, "trends", fmt.Sprintf("%s.json", tp.Name)), years, overall)
+}
+
+// The year to year variability of a region.
+type RegionYears struct {
+  I int
+  J int
+
+  // The byte encoded pleasant days of each month and of the whole year for
+  // each year.
+  Months [][12]byte
+  Totals []int
+
+  // The years with the most and fewest pleasant days and the standard
+  // deviation of the yearly fraction of pleasant days. Years without data
+  // are ignored.
+  Best   int
+  Worst  int
+  StdDev float64
+}
+
+// Summarize the yearly data for a region.
+func toRegionYears(r *RegionStats, years []int) *RegionYears {
+  ry := &RegionYears{
+    I:      r.I,
+    J:      r.J,
+    Months: make([][12]byte, len(r.Years)),
+    Totals: make([]int, len(r.Years)),
+  }
+
+  var fracs []float64
+  best, worst := -1.0, 2.0
+  for y, data := range r.Years {
+    var p Pct
+    for m := 0; m < 12; m++ {
+      ry.Months[y][m] = data[m].Byte()
+      p.A += data[m].A
+      p.B += data[m].B
+    }
+    ry.Totals[y] = int(p.Byte())
+
+    if p.B == 0 {
+      continue
+    }
+
+    f := p.A / p.B
+    fracs = append(fracs, f)
+    if f > best {
+      best, ry.Best = f, years[y]
+    }
+    if f < worst {
+      worst, ry.Worst = f, years[y]
+    }
+  }
+
+  if len(fracs) > 0 {
+    var mean float64
+    for _, f := range fracs {
+      mean += f
+    }
+    mean /= float64(len(fracs))
+
+    var v float64
+    for _, f := range fracs {
+      v += (f - mean) * (f - mean)
+    }
+    ry.StdDev = math.Sqrt(v / float64(len(fracs)))
+  }
+
+  return ry
+}
+
+// The trend in the number of pleasant days over the years.
+type Trend struct {
+  // The number of years with data.
+  N int
+
+  // The fitted change in pleasant days per year.
+  Slope     float64
+  Intercept float64
+  R2        float64
+
+  // The Mann-Kendall test for a monotonic trend.
+  S int
+  Z float64
+  P float64
+}
+
+// Compute the trend of the values v for the given years, returning nil when
+// there are too few years to say anything.
+func toTrend(years, v []float64) *Trend {
+  if len(v) < 3 {
+    return nil
+  }
+
+  f := stats.LinearFit(years, v)
+  mk := stats.MannKendallTest(v)
+  return &Trend{
+    N:         len(v),
+    Slope:     f.Slope,
+    Intercept: f.Intercept,
+    R2:        f.R2,
+    S:         mk.S,
+    Z:         mk.Z,
+    P:         mk.P,
+  }
+}
+
+// The trends for each month of the year and for the year as a whole.
+type RegionTrends struct {
+  I      int
+  J      int
+  Months [12]*Trend
+  Year   *Trend
+}
+
+// Compute the trends for a region. The pleasant fraction of each month is
+// scaled by the days in that month so that the trends are in days.
+func toRegionTrends(r *RegionStats, years []int) *RegionTrends {
+  rt := &RegionTrends{
+    I: r.I,
+    J: r.J,
+  }
+
+  for m := 0; m < 12; m++ {
+    var x, v []float64
+    for y, data := range r.Years {
+      if data[m].B == 0 {
+        continue
+      }
+      days := time.Date(years[y], time.Month(m+2), 0, 0, 0, 0, 0, time.UTC).Day()
+      x = append(x, float64(years[y]))
+      v = append(v, float64(days)*data[m].A/data[m].B)
+    }
+    rt.Months[m] = toTrend(x, v)
+  }
+
+  var yx, yv []float64
+  for y, data := range r.Years {
+    var p Pct
+    for m := 0; m < 12; m++ {
+      p.A += data[m].A
+      p.B += data[m].B
+    }
+
+    if p.B == 0 {
+      continue
+    }
+
+    _, days := util.YearInfo(years[y])
+    yx = append(yx, float64(years[y]))
+    yv = append(yv, float64(days)*p.A/p.B)
+  }
+  rt.Year = toTrend(yx, yv)
+
+  return rt
+}
+
+// Write the trends for each region.
+func WriteTrendsFile(filename string, years []int, regions []*RegionStats) error {
+  if err := EnsureDir(filepath.Dir(filename)); err != nil {
+    return err
+  }
+
+  var s struct {
+    Years   []int
+    Regions []*RegionTrends
+  }
+
+  s.Years = years
+  for _, r := range regions {
+    s.Regions = append(s.Regions, toRegionTrends(r, years))
+  }
+
+  return util.WriteJson(filename, &s)
+}
+
+// Write the per-year data for each region.
+func WriteYearsFile(filename string, years []int, regions []*RegionStats) error {
+  if err := EnsureDir(filepath.Dir(filename)); err != nil {
+    return err
+  }
+
+  var s struct {
+    Years   []int
+    Regions []*RegionYears
+  }
+
+  s.Years = years
+  for _, r := range regions {
+    s.Regions = append(s.Regions, toRegionYears(r, years))
+  }
+
+  return util.WriteJson(filename, &s)
 }
 
 // the data for key largo is jacked up, so just copy the data for long key
@@ -581,8 +1272,14 @@ func WriteStatsFiles(dir string, store *gsod.Store, grid *Grid, tp *TempPref) er
 func hackKeyLargo(m RegionStatsMap) {
   kl := m.Get(77, 42)
   lk := m.Get(77, 43)
+  if kl == nil || lk == nil {
+    return
+  }
   kl.Months = lk.Months
   kl.Total = lk.Total
+  kl.Comfort = lk.Comfort
+  kl.ComfortTotal = lk.ComfortTotal
+  kl.Years = lk.Years
 }
 
 type Zip struct {
@@ -733,7 +1430,7 @@ func writeZipFiles(dir, prefix string, n int, zips []*zipIndexEntry) error {
     name = fmt.Sprintf("%s.json", prefix)
   }
 
-  return WriteJson(filepath.Join(dir, name), m)
+  return util.WriteJson(filepath.Join(dir, name), m)
 }
 
 // Generates all the files that make up the zip-code index. This is
@@ -769,6 +1466,42 @@ func WriteZipIndex(dir string, grid *Grid, n int) error {
   return writeZipFiles(dir, "", n, zips)
 }
 
+// Parse a year (2013) or a range of years (1990-2013).
+func ParseYears(s string) ([]int, error) {
+  v := strings.Split(s, "-")
+  if len(v) > 2 {
+    return nil, fmt.Errorf("invalid years: %s", s)
+  }
+
+  b, err := strconv.ParseInt(v[0], 10, 64)
+  if err != nil {
+    return nil, err
+  }
+
+  e := b
+  if len(v) == 2 {
+    if e, err = strconv.ParseInt(v[1], 10, 64); err != nil {
+      return nil, err
+    }
+  }
+
+  var years []int
+  for i := int(b); i <= int(e); i++ {
+    years = append(years, i)
+  }
+  return years, nil
+}
+
+// Write a summary of the malformed records that were skipped.
+func ReportErrors(w io.Writer, errs []*gsod.FileErrors) {
+  for _, fe := range errs {
+    fmt.Fprintf(w, "%s:%s: skipped %d records\n", fe.File, fe.Member, fe.Count)
+    for _, err := range fe.Errors {
+      fmt.Fprintf(w, "  %d:%d-%d: %s\n    %q\n", err.Line, err.Begin, err.End, err.Err, err.Text)
+    }
+  }
+}
+
 // Just ensure that the directory exists.
 func EnsureDir(path string) error {
   if _, err := os.Stat(path); err != nil {
@@ -810,43 +1543,188 @@ func WriteGridInfoFile(filename string, grid *Grid) error {
   return nil
 }
 
+// Whether the named flag was given on the command line.
+func flagWasSet(name string) bool {
+  set := false
+  flag.Visit(func(f *flag.Flag) {
+    if f.Name == name {
+      set = true
+    }
+  })
+  return set
+}
+
 func main() {
   flagWork := flag.String("work", "work", "the destination work directory")
   flagData := flag.String("data", "data", "the source data directory")
+  flagLenient := flag.Bool("lenient", false, "skip malformed GSOD records instead of failing")
+  flagJobs := flag.Int("j", runtime.NumCPU(), "the number of years to read concurrently")
+  flagPrefs := flag.String("prefs", "", "the preferences file (default: <data>/prefs.json)")
+  flagGrid := flag.String("grid", "", "the grid config file (default: <data>/grid.json)")
+  flagSource := flag.String("source", "gsod", "the dataset in the data directory, either gsod or ghcnd")
+  flagYears := flag.String("years", "1990-2013", "the years to read from ghcnd, a year or a range like 1990-2013")
+  flagKeepSuspect := flag.Bool("keep-suspect", false, "keep ghcnd values that failed a quality check, marked as suspect")
+  flagNearest := flag.Int("nearest", 20, "the number of nearby stations to draw data from for each region")
+  flagMaxDist := flag.Float64("max-dist", 0, "the distance (km) beyond which stations are not used, 0 for none")
+  flagElevLimit := flag.Float64("elev-limit", 0, "exclude stations whose elevation differs from the region's by more (m), 0 for none")
+  flagElevWeight := flag.Float64("elev-weight", 0, "the distance (m) each meter of elevation difference adds when ranking stations")
+  flagIgnoreDates := flag.Bool("ignore-dates", false, "choose stations without regard to the years they operated")
+  flagInterp := flag.String("interp", "sum", "how to combine nearby stations, one of sum, idw, kriging")
+  flagIdwPower := flag.Float64("idw-power", 2, "the power of the distance in idw")
+  flagIdwRadius := flag.Float64("idw-radius", 0, "the radius (km) beyond which idw ignores stations, 0 for none")
+  flagKrigingRange := flag.Float64("kriging-range", 500, "the range (km) of the kriging variogram")
+  flagKrigingNugget := flag.Float64("kriging-nugget", 0.1, "the nugget of the kriging variogram as a fraction of the sill")
+  flagProjection := flag.String("projection", "equirectangular",
+    fmt.Sprintf("the map projection, one of %s", strings.Join(projection.Names(), ", ")))
   flag.Parse()
 
-  var zips []*Zip
-  if err := LoadZips(filepath.Join(*flagWork, "zips.json"), &zips); err != nil {
+  if *flagJobs < 1 {
+    *flagJobs = 1
+  }
+
+  // stop reading data when interrupted
+  ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+  defer stop()
+
+  if *flagPrefs == "" {
+    *flagPrefs = filepath.Join(*flagData, "prefs.json")
+  }
+
+  prefs, err := LoadTempPrefs(*flagPrefs)
+  if err != nil {
     panic(err)
   }
 
-  store, err := gsod.OpenStore(*flagData)
+  proj, err := projection.ByName(*flagProjection)
   if err != nil {
     panic(err)
   }
 
-  var c GridConfig
-  if err := LoadGridConfig(filepath.Join(*flagData, "grid.json"), &c); err != nil {
+  var ip interp.Interpolator
+  switch *flagInterp {
+  case "sum":
+  case "idw":
+    ip = &interp.IDW{
+      Power:  *flagIdwPower,
+      Radius: *flagIdwRadius * 1000,
+    }
+  case "kriging":
+    ip = &interp.Kriging{
+      Range:  *flagKrigingRange * 1000,
+      Nugget: *flagKrigingNugget,
+    }
+  default:
+    panic(fmt.Errorf("unknown interpolation: %s", *flagInterp))
+  }
+
+  var zips []*Zip
+  if err := LoadZips(filepath.Join(*flagWork, "zips.json"), &zips); err != nil {
     panic(err)
   }
 
+  var src coriolis.Source
+  switch *flagSource {
+  case "gsod":
+    s, err := gsod.OpenStore(*flagData)
+    if err != nil {
+      panic(err)
+    }
+    s.Lenient = *flagLenient
+    src = s
+  case "ghcnd":
+    years, err := ParseYears(*flagYears)
+    if err != nil {
+      panic(err)
+    }
+
+    s, err := ghcnd.OpenStore(*flagData, years)
+    if err != nil {
+      panic(err)
+    }
+    s.KeepSuspect = *flagKeepSuspect
+    src = s
+  default:
+    panic(fmt.Errorf("unknown source: %s", *flagSource))
+  }
+  store := src.StationStore()
+
+  if *flagGrid == "" {
+    *flagGrid = filepath.Join(*flagData, "grid.json")
+  }
+
+  var c geo.GridConfig
+  if err := geo.LoadGridConfig(*flagGrid, &c); err != nil {
+    panic(err)
+  }
+
+  // the grid is laid out in the projection it was drawn in. Canvas grids that
+  // don't name one predate projections and were drawn equirectangular.
+  drawnIn := c.Projection
+  if drawnIn == "" && !c.IsGeographic() {
+    drawnIn = "equirectangular"
+  }
+
+  if drawnIn != "" && drawnIn != *flagProjection {
+    if flagWasSet("projection") {
+      panic(fmt.Errorf("%s is drawn in the %s projection, not %s", *flagGrid, drawnIn, *flagProjection))
+    }
+
+    if proj, err = projection.ByName(drawnIn); err != nil {
+      panic(err)
+    }
+  }
+
+  // likewise, a canvas grid is fit to the stations of one source.
+  fitTo := c.Source
+  if fitTo == "" && !c.IsGeographic() {
+    fitTo = "gsod"
+  }
+
+  if fitTo != "" && fitTo != *flagSource {
+    panic(fmt.Errorf("%s is fit to the %s stations, not %s", *flagGrid, fitTo, *flagSource))
+  }
+
   r := image.Rect(0, 0, 1024, 768)
-  tx := ComputeTransform(store.Stations, r)
+  var tx *projection.Transform
+  if c.IsGeographic() {
+    if tx, err = LayoutGrid(&c, *flagData, store.Stations, proj); err != nil {
+      panic(err)
+    }
+    r = image.Rect(0, 0, c.W*c.Size, c.H*c.Size)
+  } else {
+    tx = ComputeTransform(store.Stations, r, proj)
+  }
 
-  PlaceZips(zips, tx)
+  PlaceZips(zips, tx.Forward)
 
-  grid := BuildGrid(PlaceStations(store.Stations, tx), zips, r, &c)
+  var years []int
+  if !*flagIgnoreDates {
+    years = src.YearRange()
+  }
+
+  grid := BuildGrid(store, PlaceStations(store.Stations, tx.Forward), zips, r, &c, tx.Inverse,
+    &Neighbors{
+      N:          *flagNearest,
+      MaxDist:    *flagMaxDist * 1000,
+      ElevLimit:  *flagElevLimit,
+      ElevWeight: *flagElevWeight,
+      Years:      years,
+    })
 
   if err := WriteGridInfoFile(filepath.Join(*flagWork, "info.json"), grid); err != nil {
     panic(err)
   }
 
-  for _, prefs := range TempPrefs {
-    if err := WriteStatsFiles(*flagWork, store, grid, prefs); err != nil {
+  for _, pref := range prefs {
+    if err := WriteStatsFiles(ctx, *flagWork, src, grid, pref, *flagJobs, ip); err != nil {
       panic(err)
     }
   }
 
+  if s, ok := src.(*gsod.Store); ok {
+    ReportErrors(os.Stderr, s.Errors())
+  }
+
   zipDir := filepath.Join(*flagWork, "z")
   if err := EnsureDir(zipDir); err != nil {
     panic(err)
@@ -0,0 +1,85 @@
+package main
+
+import (
+  "coriolis"
+  "coriolis/ghcnd"
+  "flag"
+  "fmt"
+  "geo"
+  "math"
+  "os"
+  "projection"
+  "strings"
+  "util"
+)
+
+// Compute the grid config for cells of the given size on a virtual canvas
+// of w x h, activating the cells that intersect the polygons. The config
+// records the projection and the station source the canvas was fit to, both
+// of which build-grid must use to lay the grid out.
+func ComputeGridConfig(polys []geo.Polygon, proj, source string, tx func(float64, float64) (float64, float64), w, h, size int) *geo.GridConfig {
+  nx := int(math.Ceil(float64(w) / float64(size)))
+  ny := int(math.Ceil(float64(h) / float64(size)))
+  return &geo.GridConfig{
+    W:          nx,
+    H:          ny,
+    Size:       size,
+    Active:     geo.ActiveCells(polys, tx, float64(size), nx, ny),
+    Projection: proj,
+    Source:     source,
+  }
+}
+
+func main() {
+  flagData := flag.String("data", "data", "the source data directory")
+  flagBoundary := flag.String("boundary", "", "the boundary, as a shapefile (.shp) or GeoJSON")
+  flagSize := flag.Int("size", 10, "the size of each cell on the 1024x768 virtual canvas")
+  flagProjection := flag.String("projection", "equirectangular",
+    fmt.Sprintf("the map projection, one of %s", strings.Join(projection.Names(), ", ")))
+  flagSource := flag.String("source", "gsod", "the stations the canvas is fit to, either gsod or ghcnd")
+  flagOut := flag.String("out", "work/grid.json", "the destination grid config")
+  flag.Parse()
+
+  if *flagBoundary == "" || *flagSize < 1 {
+    flag.Usage()
+    os.Exit(1)
+  }
+
+  polys, err := geo.LoadBoundary(*flagBoundary)
+  if err != nil {
+    panic(err)
+  }
+
+  proj, err := projection.ByName(*flagProjection)
+  if err != nil {
+    panic(err)
+  }
+
+  // the virtual canvas is fit to the stations exactly as build-grid does.
+  var stations []*coriolis.Station
+  switch *flagSource {
+  case "gsod":
+    if stations, err = coriolis.LoadStations(*flagData, coriolis.InContinentalUs); err != nil {
+      panic(err)
+    }
+  case "ghcnd":
+    s, err := ghcnd.OpenStore(*flagData, nil)
+    if err != nil {
+      panic(err)
+    }
+    stations = s.Stations
+  default:
+    panic(fmt.Errorf("unknown source: %s", *flagSource))
+  }
+
+  tx := projection.Fit(proj, 1024, len(stations), func(i int) (float64, float64) {
+    return stations[i].Lat, stations[i].Lon
+  })
+
+  c := ComputeGridConfig(polys, *flagProjection, *flagSource, tx.Forward, 1024, 768, *flagSize)
+  if err := util.WriteJson(*flagOut, c); err != nil {
+    panic(err)
+  }
+
+  fmt.Printf("%dx%d cells, %d active\n", c.W, c.H, len(c.Active))
+}
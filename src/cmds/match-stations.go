@@ -0,0 +1,73 @@
+package main
+
+import (
+  "coriolis"
+  "coriolis/ghcnd"
+  "flag"
+  "fmt"
+  "io"
+  "os"
+  "util"
+)
+
+// Write the records that could have been linked to more than one station.
+func ReportAmbiguous(w io.Writer, m *coriolis.Matching) {
+  for _, a := range m.Ambiguous {
+    s := a.Record.Station
+    fmt.Fprintf(w, "%s:%s %s (%.3f, %.3f), matched by %s to:\n",
+      a.Record.Dataset, s.Id(), s.Name, s.Lat, s.Lon, a.Record.By)
+    for _, c := range a.Candidates {
+      cs := c.Station()
+      fmt.Fprintf(w, "  %s %s, %.0fm away\n", c.Id, cs.Name, s.DistanceTo(cs))
+    }
+  }
+}
+
+func main() {
+  flagData := flag.String("data", "data", "the source data directory")
+  flagGhcnd := flag.String("ghcnd", "", "the directory with ghcnd-stations.txt (default: <data>)")
+  flagDist := flag.Float64("dist", coriolis.DefaultMatchOptions.MaxDist,
+    "the distance (m) within which stations without a shared id are matched")
+  flagElev := flag.Float64("elev", coriolis.DefaultMatchOptions.MaxElevDiff,
+    "the most the elevations (m) of matched stations may differ")
+  flagName := flag.Float64("name", coriolis.DefaultMatchOptions.MinNameSimilarity,
+    "the least similar (0-1) the names of matched stations may be")
+  flagOut := flag.String("out", "work/stations.json", "the destination for the canonical stations")
+  flag.Parse()
+
+  if *flagGhcnd == "" {
+    *flagGhcnd = *flagData
+  }
+
+  gsod, err := coriolis.LoadStations(*flagData, coriolis.InContinentalUs)
+  if err != nil {
+    panic(err)
+  }
+
+  ghcn, err := ghcnd.LoadStations(*flagGhcnd, coriolis.InContinentalUs)
+  if err != nil {
+    panic(err)
+  }
+
+  o := coriolis.DefaultMatchOptions
+  o.MaxDist = *flagDist
+  o.MaxElevDiff = *flagElev
+  o.MinNameSimilarity = *flagName
+
+  m := coriolis.Match([]*coriolis.Dataset{
+    &coriolis.Dataset{Name: "gsod", Stations: gsod},
+    &coriolis.Dataset{Name: "ghcnd", Stations: ghcn},
+  }, &o)
+
+  if err := util.WriteJson(*flagOut, m.Stations); err != nil {
+    panic(err)
+  }
+
+  ReportAmbiguous(os.Stdout, m)
+
+  linked := 0
+  for _, c := range m.Stations {
+    linked += len(c.Records) - 1
+  }
+  fmt.Printf("%d stations, %d linked, %d ambiguous\n", len(m.Stations), linked, len(m.Ambiguous))
+}
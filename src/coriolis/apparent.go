@@ -0,0 +1,95 @@
+package coriolis
+
+import (
+  "math"
+)
+
+// The number of statute miles per hour in a knot.
+const mphPerKnot = 1.150779
+
+// Convert fahrenheit to celsius.
+func toCelsius(f float64) float64 {
+  return (f - 32) * 5 / 9
+}
+
+// The relative humidity (0-100) for air at temperature t with dew point td,
+// both in fahrenheit. This uses the Magnus approximation for vapor pressure.
+func RelativeHumidity(t, td float64) float64 {
+  es := func(c float64) float64 {
+    return 6.112 * math.Exp(17.67*c/(c+243.5))
+  }
+  rh := 100 * es(toCelsius(td)) / es(toCelsius(t))
+  if rh > 100 {
+    return 100
+  }
+  return rh
+}
+
+// The NWS heat index for temperature t (fahrenheit) and relative humidity rh
+// (0-100). See http://www.wpc.ncep.noaa.gov/html/heatindex_equation.shtml
+func HeatIndex(t, rh float64) float64 {
+  hi := 0.5 * (t + 61 + (t-68)*1.2 + rh*0.094)
+  if (hi+t)/2 < 80 {
+    return hi
+  }
+
+  hi = -42.379 + 2.04901523*t + 10.14333127*rh -
+    0.22475541*t*rh - 0.00683783*t*t - 0.05481717*rh*rh +
+    0.00122874*t*t*rh + 0.00085282*t*rh*rh - 0.00000199*t*t*rh*rh
+
+  if rh < 13 && t >= 80 && t <= 112 {
+    hi -= ((13 - rh) / 4) * math.Sqrt((17-math.Abs(t-95))/17)
+  } else if rh > 85 && t >= 80 && t <= 87 {
+    hi += ((rh - 85) / 10) * ((87 - t) / 5)
+  }
+
+  return hi
+}
+
+// The NWS wind chill for temperature t (fahrenheit) and wind speed v (mph).
+// Wind chill is only defined at or below 50F with winds of at least 3 mph,
+// outside of that t is returned.
+func WindChill(t, v float64) float64 {
+  if t > 50 || v < 3 {
+    return t
+  }
+
+  p := math.Pow(v, 0.16)
+  return 35.74 + 0.6215*t - 35.75*p + 0.4275*t*p
+}
+
+// The heat index of the mean temperature, which requires both TempAvg and
+// DewPoint.
+func (s *Summary) HeatIndex() (float64, bool) {
+  if !s.Has(FieldTempAvg | FieldDewPoint) {
+    return 0, false
+  }
+  return HeatIndex(s.TempAvg, RelativeHumidity(s.TempAvg, s.DewPoint)), true
+}
+
+// The wind chill of the mean temperature, which requires both TempAvg and
+// WindAvg.
+func (s *Summary) WindChill() (float64, bool) {
+  if !s.Has(FieldTempAvg | FieldWindAvg) {
+    return 0, false
+  }
+  return WindChill(s.TempAvg, s.WindAvg*mphPerKnot), true
+}
+
+// The temperature t (fahrenheit), typically one of TempAvg, TempMax or
+// TempMin, as it would feel given the day's humidity and wind. Warm
+// temperatures use the heat index, cold temperatures use the wind chill and
+// t is returned unchanged when the data needed is missing.
+func (s *Summary) ApparentTemp(t float64) float64 {
+  if t >= 80 && s.Has(FieldDewPoint) {
+    // the dew point changes little through the day, so the daily mean is a
+    // reasonable stand-in at any temperature.
+    return HeatIndex(t, RelativeHumidity(t, math.Min(s.DewPoint, t)))
+  }
+
+  if t <= 50 && s.Has(FieldWindAvg) {
+    return WindChill(t, s.WindAvg*mphPerKnot)
+  }
+
+  return t
+}
@@ -0,0 +1,70 @@
+package coriolis
+
+import (
+  "math"
+  "testing"
+)
+
+func near(a, b, e float64) bool {
+  return math.Abs(a-b) <= e
+}
+
+func TestHeatIndex(t *testing.T) {
+  // values from the NWS heat index chart
+  if hi := HeatIndex(90, 50); !near(hi, 95, 1) {
+    t.Errorf("expected heat index of 95, got %v", hi)
+  }
+
+  if hi := HeatIndex(100, 40); !near(hi, 109, 1) {
+    t.Errorf("expected heat index of 109, got %v", hi)
+  }
+
+  if hi := HeatIndex(70, 50); !near(hi, 69, 1) {
+    t.Errorf("expected heat index of 69, got %v", hi)
+  }
+}
+
+func TestWindChill(t *testing.T) {
+  // values from the NWS wind chill chart
+  if wc := WindChill(30, 20); !near(wc, 17, 1) {
+    t.Errorf("expected wind chill of 17, got %v", wc)
+  }
+
+  if wc := WindChill(0, 15); !near(wc, -19, 1) {
+    t.Errorf("expected wind chill of -19, got %v", wc)
+  }
+
+  if wc := WindChill(60, 20); wc != 60 {
+    t.Errorf("expected no wind chill above 50F, got %v", wc)
+  }
+}
+
+func TestApparentTemp(t *testing.T) {
+  s := &Summary{
+    TempAvg:  90,
+    DewPoint: 70,
+    WindAvg:  10,
+    Valid:    FieldTempAvg | FieldDewPoint | FieldWindAvg,
+  }
+
+  if hi, ok := s.HeatIndex(); !ok || hi <= 90 {
+    t.Errorf("expected a heat index above 90, got %v", hi)
+  }
+
+  if at := s.ApparentTemp(65); at != 65 {
+    t.Errorf("expected 65 to be unchanged, got %v", at)
+  }
+
+  if at := s.ApparentTemp(40); at >= 40 {
+    t.Errorf("expected wind to make 40 feel colder, got %v", at)
+  }
+
+  s.Valid = FieldTempAvg
+  if _, ok := s.WindChill(); ok {
+    t.Errorf("expected no wind chill without wind")
+  }
+
+  if at := s.ApparentTemp(90); at != 90 {
+    t.Errorf("expected 90 to be unchanged without a dew point, got %v", at)
+  }
+}
@@ -8,21 +8,56 @@ import (
   "path/filepath"
   "strconv"
   "strings"
+  "sync"
+  "time"
 )
 
-const HistoryFile = "ish-history.csv"
+// The station history files NOAA has published. The newer isd-history.csv is
+// preferred when both are present.
+const (
+  HistoryFile    = "ish-history.csv"
+  IsdHistoryFile = "isd-history.csv"
+)
 
 type Station struct {
-  Usaf     string
-  Wban     string
+  Usaf string
+  Wban string
+
+  // The GHCN-Daily id of stations that come from that dataset.
+  Ghcn string
+
   Name     string
   Call     string
   Country  string
   State    string
   Lat, Lon float64
+
+  // The elevation in meters, which is only meaningful if HasElev.
+  Elev    float64
+  HasElev bool
+
+  // The first and last days the station reported, which are zero when
+  // unknown.
+  Begin time.Time
+  End   time.Time
+}
+
+// Whether the station was operating for any part of the year. A station with
+// unknown dates is assumed to always be operating.
+func (s *Station) ActiveIn(year int) bool {
+  if !s.Begin.IsZero() && s.Begin.Year() > year {
+    return false
+  }
+  if !s.End.IsZero() && s.End.Year() < year {
+    return false
+  }
+  return true
 }
 
 func (s *Station) Id() string {
+  if s.Usaf == "" && s.Ghcn != "" {
+    return s.Ghcn
+  }
   return fmt.Sprintf("%s-%s", s.Usaf, s.Wban)
 }
 
@@ -30,6 +65,40 @@ type Store struct {
   Dir          string
   Stations     []*Station
   StationIndex map[string]*Station
+
+  once sync.Once
+  tree *kdTree
+}
+
+// Find the k stations nearest to the point (lat, lon) by great-circle distance,
+// ordered from nearest to farthest. Stations more than maxDist meters away are
+// excluded unless maxDist is 0. The spatial index over Stations is built on
+// first use, so Stations should not change afterward.
+func (s *Store) Nearest(lat, lon float64, k int, maxDist float64) []*Station {
+  return s.NearestMatching(lat, lon, k, maxDist, nil)
+}
+
+// The stations that were operating during the given year.
+func (s *Store) ActiveStations(year int) []*Station {
+  var stations []*Station
+  for _, station := range s.Stations {
+    if station.ActiveIn(year) {
+      stations = append(stations, station)
+    }
+  }
+  return stations
+}
+
+// Like Nearest but only considers the stations for which fn returns true.
+func (s *Store) NearestMatching(lat, lon float64, k int, maxDist float64, fn func(s *Station) bool) []*Station {
+  if k <= 0 {
+    return nil
+  }
+
+  s.once.Do(func() {
+    s.tree = newKdTree(s.Stations)
+  })
+  return s.tree.nearest(lat, lon, k, maxDist, fn)
 }
 
 func OpenStore(dir string) (*Store, error) {
@@ -39,6 +108,11 @@ func OpenStore(dir string) (*Store, error) {
     return nil, err
   }
 
+  return NewStore(dir, stations), nil
+}
+
+// Create a store of the given stations, whose data is in dir.
+func NewStore(dir string, stations []*Station) *Store {
   // build index
   index := map[string]*Station{}
   for _, station := range stations {
@@ -49,16 +123,27 @@ func OpenStore(dir string) (*Store, error) {
     Dir:          dir,
     Stations:     stations,
     StationIndex: index,
-  }, nil
+  }
 }
 
-func parseLatLon(s string, v *float64) error {
+// Parse a latitude or longitude given either in decimal degrees or, in the older
+// history file, in thousandths of a degree.
+func parseLatLon(s string, decimal bool, v *float64) error {
   *v = 0
   s = strings.TrimSpace(s)
   if s == "" {
     return nil
   }
 
+  if decimal {
+    f, err := strconv.ParseFloat(s, 64)
+    if err != nil {
+      return err
+    }
+    *v = f
+    return nil
+  }
+
   n, err := strconv.ParseInt(s[1:], 10, 64)
   if err != nil {
     return err
@@ -72,17 +157,144 @@ func parseLatLon(s string, v *float64) error {
   return nil
 }
 
+// Parse an elevation given either in meters or, in the older history file, in
+// tenths of a meter. Unknown elevations are left empty or given as -999 meters
+// or less.
+func parseElev(s string, decimal bool, v *float64, has *bool) error {
+  *v, *has = 0, false
+  s = strings.TrimSpace(s)
+  if s == "" || s == "-99999" {
+    return nil
+  }
+
+  if decimal {
+    f, err := strconv.ParseFloat(s, 64)
+    if err != nil {
+      return err
+    }
+    if f > -999 {
+      *v, *has = f, true
+    }
+    return nil
+  }
+
+  n, err := strconv.ParseInt(strings.TrimPrefix(s, "+"), 10, 64)
+  if err != nil {
+    return err
+  }
+
+  *v, *has = float64(n)/10, true
+  return nil
+}
+
+// Parse a date in the form YYYYMMDD, which may be empty.
+func parseDate(s string, v *time.Time) error {
+  *v = time.Time{}
+  s = strings.TrimSpace(s)
+  if s == "" {
+    return nil
+  }
+
+  t, err := time.Parse("20060102", s)
+  if err != nil {
+    return err
+  }
+
+  *v = t
+  return nil
+}
+
+// The positions of the columns in a station history file, which are -1 for
+// missing columns.
+type historyColumns struct {
+  usaf, wban, name, country, state, call int
+  lat, lon, elev, begin, end             int
+
+  // Whether lat, lon & elev are in degrees & meters rather than the older
+  // thousandths of a degree & tenths of a meter.
+  decimal bool
+}
+
+// Map the columns of a station history file from its header, which also tells
+// the older ish-history.csv format from the newer isd-history.csv.
+func columnsOf(header []string) (*historyColumns, error) {
+  idx := map[string]int{}
+  for i, name := range header {
+    idx[strings.ToUpper(strings.TrimSpace(name))] = i
+  }
+
+  col := func(names ...string) int {
+    for _, name := range names {
+      if i, ok := idx[name]; ok {
+        return i
+      }
+    }
+    return -1
+  }
+
+  c := &historyColumns{
+    usaf:    col("USAF"),
+    wban:    col("WBAN"),
+    name:    col("STATION NAME"),
+    country: col("CTRY"),
+    state:   col("STATE"),
+    call:    col("ICAO", "CALL"),
+    lat:     col("LAT"),
+    lon:     col("LON"),
+    elev:    col("ELEV(M)", "ELEV(.1M)"),
+    begin:   col("BEGIN"),
+    end:     col("END"),
+  }
+
+  if c.usaf < 0 || c.wban < 0 || c.lat < 0 || c.lon < 0 {
+    return nil, fmt.Errorf("station history is missing USAF, WBAN, LAT or LON columns: %v", header)
+  }
+
+  _, old := idx["ELEV(.1M)"]
+  c.decimal = !old
+  return c, nil
+}
+
+// The value in column i, which is empty for missing columns.
+func valueAt(v []string, i int) string {
+  if i < 0 || i >= len(v) {
+    return ""
+  }
+  return v[i]
+}
+
+// The path of the station history file in dir.
+func historyFileIn(dir string) string {
+  filename := filepath.Join(dir, IsdHistoryFile)
+  if _, err := os.Stat(filename); err == nil {
+    return filename
+  }
+  return filepath.Join(dir, HistoryFile)
+}
+
 func ForEachStation(dir string, fn func(s *Station) error) error {
-  r, err := os.Open(filepath.Join(dir, HistoryFile))
+  r, err := os.Open(historyFileIn(dir))
   if err != nil {
     return err
   }
   defer r.Close()
 
+  return ReadStations(r, fn)
+}
+
+// Read the stations from a station history file in either the ish-history.csv or
+// isd-history.csv format.
+func ReadStations(r io.Reader, fn func(s *Station) error) error {
   cr := csv.NewReader(r)
+  cr.FieldsPerRecord = -1
+
+  header, err := cr.Read()
+  if err != nil {
+    return err
+  }
 
-  // ditch the headers
-  if _, err := cr.Read(); err != nil {
+  c, err := columnsOf(header)
+  if err != nil {
     return err
   }
 
@@ -95,18 +307,30 @@ func ForEachStation(dir string, fn func(s *Station) error) error {
       return err
     }
 
-    s.Usaf = v[0]
-    s.Wban = v[1]
-    s.Name = v[2]
-    s.Country = v[3]
-    s.State = v[5]
-    s.Call = v[6]
+    s.Usaf = valueAt(v, c.usaf)
+    s.Wban = valueAt(v, c.wban)
+    s.Name = valueAt(v, c.name)
+    s.Country = valueAt(v, c.country)
+    s.State = valueAt(v, c.state)
+    s.Call = valueAt(v, c.call)
+
+    if err := parseLatLon(valueAt(v, c.lat), c.decimal, &s.Lat); err != nil {
+      return err
+    }
+
+    if err := parseLatLon(valueAt(v, c.lon), c.decimal, &s.Lon); err != nil {
+      return err
+    }
+
+    if err := parseElev(valueAt(v, c.elev), c.decimal, &s.Elev, &s.HasElev); err != nil {
+      return err
+    }
 
-    if err := parseLatLon(v[7], &s.Lat); err != nil {
+    if err := parseDate(valueAt(v, c.begin), &s.Begin); err != nil {
       return err
     }
 
-    if err := parseLatLon(v[8], &s.Lon); err != nil {
+    if err := parseDate(valueAt(v, c.end), &s.End); err != nil {
       return err
     }
 
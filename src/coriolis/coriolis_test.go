@@ -0,0 +1,113 @@
+package coriolis
+
+import (
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+const testHistory = `"USAF","WBAN","STATION NAME","CTRY","FIPS","STATE","CALL","LAT","LON","ELEV(.1M)","BEGIN","END"
+"724695","23062","DENVER/STAPLETON","US","US","CO","KDEN","+39767","-104869","+16110","19730101","19950515"
+"720000","99999","NOWHERE","US","US","CO","","+39000","-105000","-99999","",""
+`
+
+const testIsdHistory = `"USAF","WBAN","STATION NAME","CTRY","STATE","ICAO","LAT","LON","ELEV(M)","BEGIN","END"
+"725650","03017","DENVER INTERNATIONAL AIRPORT","US","CO","KDEN","+39.833","-104.658","+1650.2","19940718","20131231"
+"999999","99999","UNKNOWN","US","","","","","","",""
+`
+
+func TestReadIsdHistory(t *testing.T) {
+  var stations []Station
+  if err := ReadStations(strings.NewReader(testIsdHistory), func(s *Station) error {
+    stations = append(stations, *s)
+    return nil
+  }); err != nil {
+    t.Fatal(err)
+  }
+
+  if len(stations) != 2 {
+    t.Fatalf("expected 2 stations, got %d", len(stations))
+  }
+
+  s := &stations[0]
+  if s.Id() != "725650-03017" || s.Call != "KDEN" || s.State != "CO" || s.Lat != 39.833 || s.Lon != -104.658 {
+    t.Errorf("bad station: %+v", s)
+  }
+
+  if !s.HasElev || s.Elev != 1650.2 {
+    t.Errorf("expected elevation 1650.2, got %v (%v)", s.Elev, s.HasElev)
+  }
+
+  if s.Begin.Year() != 1994 || s.End.Year() != 2013 {
+    t.Errorf("bad dates: %v - %v", s.Begin, s.End)
+  }
+
+  s = &stations[1]
+  if s.Lat != 0 || s.Lon != 0 || s.HasElev || !s.Begin.IsZero() {
+    t.Errorf("expected empty station, got %+v", s)
+  }
+}
+
+func TestHistoryMissingColumns(t *testing.T) {
+  err := ReadStations(strings.NewReader("\"USAF\",\"NAME\"\n"), func(s *Station) error {
+    return nil
+  })
+  if err == nil {
+    t.Error("expected an error for missing columns")
+  }
+}
+
+func TestForEachStation(t *testing.T) {
+  dir, err := ioutil.TempDir("", "coriolis")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+
+  if err := ioutil.WriteFile(filepath.Join(dir, HistoryFile), []byte(testHistory), 0644); err != nil {
+    t.Fatal(err)
+  }
+
+  stations, err := LoadStations(dir, func(s *Station) bool { return true })
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if len(stations) != 2 {
+    t.Fatalf("expected 2 stations, got %d", len(stations))
+  }
+
+  s := stations[0]
+  if s.Id() != "724695-23062" || s.Call != "KDEN" || s.Lat != 39.767 || s.Lon != -104.869 {
+    t.Errorf("bad station: %+v", s)
+  }
+
+  if !s.HasElev || s.Elev != 1611 {
+    t.Errorf("expected elevation 1611, got %v (%v)", s.Elev, s.HasElev)
+  }
+
+  if stations[1].HasElev {
+    t.Errorf("expected no elevation, got %v", stations[1].Elev)
+  }
+
+  if s.Begin.Year() != 1973 || s.End.Year() != 1995 || s.End.Day() != 15 {
+    t.Errorf("bad dates: %v - %v", s.Begin, s.End)
+  }
+
+  st := &Store{Stations: stations}
+  for _, test := range []struct {
+    year int
+    n    int
+  }{
+    {1972, 1},
+    {1973, 2},
+    {1995, 2},
+    {1996, 1},
+  } {
+    if n := len(st.ActiveStations(test.year)); n != test.n {
+      t.Errorf("%d: expected %d active stations, got %d", test.year, test.n, n)
+    }
+  }
+}
@@ -0,0 +1,26 @@
+package coriolis
+
+import (
+  "math"
+  "projection"
+)
+
+func toRadians(d float64) float64 {
+  return d * math.Pi / 180
+}
+
+// The great-circle distance in meters between two points given in degrees,
+// computed with the haversine formula.
+func Distance(lat0, lon0, lat1, lon1 float64) float64 {
+  p0, p1 := toRadians(lat0), toRadians(lat1)
+  dp, dl := p1-p0, toRadians(lon1-lon0)
+
+  a := math.Sin(dp/2)*math.Sin(dp/2) +
+    math.Cos(p0)*math.Cos(p1)*math.Sin(dl/2)*math.Sin(dl/2)
+  return 2 * projection.EarthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// The great-circle distance in meters between two stations.
+func (s *Station) DistanceTo(o *Station) float64 {
+  return Distance(s.Lat, s.Lon, o.Lat, o.Lon)
+}
@@ -0,0 +1,17 @@
+package coriolis
+
+import (
+  "math"
+  "testing"
+)
+
+func TestDistance(t *testing.T) {
+  // JFK to LAX is about 3974 km on a sphere
+  if d := Distance(40.6413, -73.7781, 33.9416, -118.4085); math.Abs(d-3974e3) > 5e3 {
+    t.Errorf("expected about 3974km, got %v", d)
+  }
+
+  if d := Distance(39.7, -105.0, 39.7, -105.0); d != 0 {
+    t.Errorf("expected 0, got %v", d)
+  }
+}
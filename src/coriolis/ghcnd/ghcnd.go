@@ -0,0 +1,513 @@
+// Package ghcnd reads the stations and daily summaries of GHCN-Daily, NOAA's
+// Global Historical Climatology Network.
+package ghcnd
+
+import (
+  "bufio"
+  "coriolis"
+  "fmt"
+  "io"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
+)
+
+// The list of stations, the years each station reported each element and the
+// directory of per-station .dly files, as they are unpacked from
+// ghcnd_all.tar.gz.
+const (
+  StationsFile  = "ghcnd-stations.txt"
+  InventoryFile = "ghcnd-inventory.txt"
+  DailyDir      = "ghcnd_all"
+)
+
+// The elements that report temperature. Stations that report none of them,
+// such as those that only measure precipitation, are left out.
+var tempElements = map[string]bool{
+  "TMAX": true,
+  "TMIN": true,
+  "TAVG": true,
+}
+
+// The value used in .dly files for missing values.
+const missing = -9999
+
+// The length of a complete line in a .dly file, 31 days of 8 bytes each
+// following the 21 byte header.
+const dlyLineLength = 21 + 31*8
+
+const knotsPerMps = 1.943844
+
+type Store struct {
+  *coriolis.Store
+  Years []int
+
+  // When set, values that failed a quality check are kept and marked in
+  // Summary.Suspect rather than dropped.
+  KeepSuspect bool
+
+  lck     sync.Mutex
+  indexes map[*coriolis.Station]*stationIndex
+}
+
+// Open the GHCN-Daily data in dir for the given years. Like GSOD, only
+// stations in the continental US are included and, of those, only the ones
+// that report temperature according to the inventory.
+func OpenStore(dir string, years []int) (*Store, error) {
+  stations, err := LoadStations(dir, coriolis.InContinentalUs)
+  if err != nil {
+    return nil, err
+  }
+
+  if stations, err = withTemperature(dir, stations); err != nil {
+    return nil, err
+  }
+
+  return &Store{
+    Store: coriolis.NewStore(dir, stations),
+    Years: years,
+  }, nil
+}
+
+// The stations in the store, to satisfy coriolis.Source.
+func (s *Store) StationStore() *coriolis.Store {
+  return s.Store
+}
+
+// The years of the store, to satisfy coriolis.Source.
+func (s *Store) YearRange() []int {
+  return s.Years
+}
+
+// Parse the fixed-width float in columns [b,e) of l.
+func parseFloat(l string, b, e int) (float64, error) {
+  return strconv.ParseFloat(strings.TrimSpace(l[b:e]), 64)
+}
+
+// Parse a single line of ghcnd-stations.txt into s.
+func toStation(s *coriolis.Station, l string) error {
+  if len(l) < 71 {
+    return fmt.Errorf("short line: %q", l)
+  }
+
+  *s = coriolis.Station{}
+  s.Ghcn = l[0:11]
+  s.Country = l[0:2]
+  s.State = strings.TrimSpace(l[38:40])
+  s.Name = strings.TrimSpace(l[41:71])
+
+  // the stations of the US first-order network are identified by WBAN.
+  if l[2] == 'W' {
+    s.Wban = l[6:11]
+  }
+
+  var err error
+  if s.Lat, err = parseFloat(l, 12, 20); err != nil {
+    return err
+  }
+
+  if s.Lon, err = parseFloat(l, 21, 30); err != nil {
+    return err
+  }
+
+  if s.Elev, err = parseFloat(l, 31, 37); err != nil {
+    return err
+  }
+  s.HasElev = s.Elev > -999
+
+  return nil
+}
+
+func ForEachStation(dir string, fn func(s *coriolis.Station) error) error {
+  r, err := os.Open(filepath.Join(dir, StationsFile))
+  if err != nil {
+    return err
+  }
+  defer r.Close()
+
+  var s coriolis.Station
+  sc := bufio.NewScanner(r)
+  n := 0
+  for sc.Scan() {
+    n++
+    if err := toStation(&s, sc.Text()); err != nil {
+      return fmt.Errorf("%s:%d: %s", StationsFile, n, err)
+    }
+
+    if err := fn(&s); err != nil {
+      return err
+    }
+  }
+
+  return sc.Err()
+}
+
+func LoadStations(dir string, fn func(s *coriolis.Station) bool) ([]*coriolis.Station, error) {
+  var stations []*coriolis.Station
+  if err := ForEachStation(dir, func(s *coriolis.Station) error {
+    if !fn(s) {
+      return nil
+    }
+
+    ns := *s
+    stations = append(stations, &ns)
+    return nil
+  }); err != nil {
+    return nil, err
+  }
+
+  return stations, nil
+}
+
+// The years in which a station reported an element, a single line of
+// ghcnd-inventory.txt.
+type Inventory struct {
+  Id        string
+  Element   string
+  FirstYear int
+  LastYear  int
+}
+
+// Parse a single line of ghcnd-inventory.txt into v.
+func toInventory(v *Inventory, l string) error {
+  if len(l) < 45 {
+    return fmt.Errorf("short line: %q", l)
+  }
+
+  v.Id = l[0:11]
+  v.Element = l[31:35]
+
+  var err error
+  if v.FirstYear, err = strconv.Atoi(l[36:40]); err != nil {
+    return err
+  }
+
+  if v.LastYear, err = strconv.Atoi(l[41:45]); err != nil {
+    return err
+  }
+
+  return nil
+}
+
+func ForEachInventory(dir string, fn func(v *Inventory) error) error {
+  r, err := os.Open(filepath.Join(dir, InventoryFile))
+  if err != nil {
+    return err
+  }
+  defer r.Close()
+
+  var v Inventory
+  sc := bufio.NewScanner(r)
+  n := 0
+  for sc.Scan() {
+    n++
+    if err := toInventory(&v, sc.Text()); err != nil {
+      return fmt.Errorf("%s:%d: %s", InventoryFile, n, err)
+    }
+
+    if err := fn(&v); err != nil {
+      return err
+    }
+  }
+
+  return sc.Err()
+}
+
+// Keep only the stations that report temperature, setting the Begin and End
+// of each to the first and last years in which it did.
+func withTemperature(dir string, stations []*coriolis.Station) ([]*coriolis.Station, error) {
+  index := map[string]*coriolis.Station{}
+  for _, s := range stations {
+    index[s.Ghcn] = s
+  }
+
+  found := map[*coriolis.Station]bool{}
+  if err := ForEachInventory(dir, func(v *Inventory) error {
+    s := index[v.Id]
+    if s == nil || !tempElements[v.Element] {
+      return nil
+    }
+
+    b := time.Date(v.FirstYear, time.January, 1, 0, 0, 0, 0, time.UTC)
+    e := time.Date(v.LastYear, time.December, 31, 0, 0, 0, 0, time.UTC)
+    if !found[s] || b.Before(s.Begin) {
+      s.Begin = b
+    }
+    if !found[s] || e.After(s.End) {
+      s.End = e
+    }
+    found[s] = true
+    return nil
+  }); err != nil {
+    return nil, err
+  }
+
+  res := make([]*coriolis.Station, 0, len(found))
+  for _, s := range stations {
+    if found[s] {
+      res = append(res, s)
+    }
+  }
+  return res, nil
+}
+
+// A single value of a .dly record along with its flags. Blank flags are
+// spaces.
+type Value struct {
+  Value int
+
+  // The measurement, quality and source flags.
+  MFlag byte
+  QFlag byte
+  SFlag byte
+}
+
+// Whether the value is absent.
+func (v *Value) Missing() bool {
+  return v.Value == missing
+}
+
+// Whether the value failed one of the quality checks.
+func (v *Value) Failed() bool {
+  return v.QFlag != ' '
+}
+
+// A single line of a .dly file, which holds one element of one station for
+// every day of a month.
+type Record struct {
+  Id      string
+  Year    int
+  Month   int
+  Element string
+  Values  [31]Value
+}
+
+// Parse a single line of a .dly file into r.
+func ParseRecord(l string, r *Record) error {
+  if len(l) < dlyLineLength {
+    return fmt.Errorf("short line: expected %d bytes, got %d", dlyLineLength, len(l))
+  }
+
+  r.Id = l[0:11]
+
+  var err error
+  if r.Year, err = strconv.Atoi(l[11:15]); err != nil {
+    return err
+  }
+
+  if r.Month, err = strconv.Atoi(l[15:17]); err != nil || r.Month < 1 || r.Month > 12 {
+    return fmt.Errorf("invalid month: %q", l[15:17])
+  }
+
+  r.Element = l[17:21]
+  for i := range r.Values {
+    b := 21 + i*8
+    v := &r.Values[i]
+    if v.Value, err = strconv.Atoi(strings.TrimSpace(l[b : b+5])); err != nil {
+      return fmt.Errorf("day %d: %s", i+1, err)
+    }
+    v.MFlag, v.QFlag, v.SFlag = l[b+5], l[b+6], l[b+7]
+  }
+
+  return nil
+}
+
+// Call fn with each of the records in a .dly file for which want, if not nil,
+// returns true when given the line. Errors include the line number.
+func ForEachRecord(r io.Reader, want func(l string) bool, fn func(r *Record) error) error {
+  var rec Record
+  sc := bufio.NewScanner(r)
+  n := 0
+  for sc.Scan() {
+    n++
+    l := sc.Text()
+    if want != nil && !want(l) {
+      continue
+    }
+
+    if err := ParseRecord(l, &rec); err != nil {
+      return fmt.Errorf("%d: %s", n, err)
+    }
+
+    if err := fn(&rec); err != nil {
+      return err
+    }
+  }
+
+  return sc.Err()
+}
+
+// Convert tenths of a degree celsius to fahrenheit.
+func toFahrenheit(v float64) float64 {
+  return v/10*9/5 + 32
+}
+
+// Record the value v of element e into s. Unknown elements are ignored.
+func setElement(s *coriolis.Summary, e string, v *Value) {
+  var f coriolis.Field
+  x := float64(v.Value)
+  switch e {
+  case "TMAX":
+    f, s.TempMax = coriolis.FieldTempMax, toFahrenheit(x)
+    // H is the highest hourly temperature, much like GSOD's *.
+    s.TempMaxDerived = v.MFlag == 'H'
+  case "TMIN":
+    f, s.TempMin = coriolis.FieldTempMin, toFahrenheit(x)
+    s.TempMinDerived = v.MFlag == 'H'
+  case "TAVG":
+    f, s.TempAvg = coriolis.FieldTempAvg, toFahrenheit(x)
+  case "PRCP":
+    // tenths of mm
+    f, s.Precip = coriolis.FieldPrecip, x/254
+    // describe how the total was obtained as GSOD would.
+    switch v.MFlag {
+    case 'B':
+      s.PrecipFlag = 'F'
+    case 'D':
+      s.PrecipFlag = 'D'
+    default:
+      s.PrecipFlag = 'G'
+    }
+  case "SNWD":
+    // mm
+    f, s.SnowDepth = coriolis.FieldSnowDepth, x/25.4
+  case "AWND":
+    // tenths of m/s
+    f, s.WindAvg = coriolis.FieldWindAvg, x/10*knotsPerMps
+  case "WSF2":
+    f, s.WindMax = coriolis.FieldWindMax, x/10*knotsPerMps
+  case "WSFG":
+    f, s.Gust = coriolis.FieldGust, x/10*knotsPerMps
+  case "WT01":
+    s.Events |= coriolis.EventFog
+  case "WT03":
+    s.Events |= coriolis.EventThunder
+  case "WT05":
+    s.Events |= coriolis.EventHail
+  case "WT10":
+    s.Events |= coriolis.EventTornado
+  case "WT16":
+    s.Events |= coriolis.EventRain
+  case "WT18":
+    s.Events |= coriolis.EventSnow
+  }
+
+  s.Valid |= f
+  if v.Failed() {
+    s.Suspect |= f
+  }
+}
+
+// Call fn with each of the days of a month that have a temperature. Days
+// with only precipitation or snow can't say whether the day was pleasant.
+func flushMonth(days *[31]coriolis.Summary, fn func(s *coriolis.Summary) error) error {
+  for i := range days {
+    s := &days[i]
+    if s.Valid&(coriolis.FieldTempMax|coriolis.FieldTempMin|coriolis.FieldTempAvg) == 0 {
+      continue
+    }
+
+    // without a reported mean, use the midpoint of the extremes.
+    if !s.Has(coriolis.FieldTempAvg) && s.Has(coriolis.FieldTempMax|coriolis.FieldTempMin) {
+      s.TempAvg = (s.TempMax + s.TempMin) / 2
+      s.Valid |= coriolis.FieldTempAvg
+      if s.Suspect&(coriolis.FieldTempMax|coriolis.FieldTempMin) != 0 {
+        s.Suspect |= coriolis.FieldTempAvg
+      }
+    }
+
+    if err := fn(s); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// Read the daily summaries in a station's .dly file for the given year,
+// calling fn with each day that has any data. Values that failed a quality
+// check are left out unless keepSuspect is set, in which case they are marked
+// in Summary.Suspect.
+func ForEachSummary(r io.Reader, station *coriolis.Station, year int, keepSuspect bool, fn func(s *coriolis.Summary) error) error {
+  yr := strconv.Itoa(year)
+
+  var days [31]coriolis.Summary
+  month := 0
+  if err := ForEachRecord(r,
+    func(l string) bool {
+      return len(l) >= 15 && l[11:15] == yr
+    },
+    func(rec *Record) error {
+      // the records are ordered by month, so the previous month is complete.
+      if rec.Month != month {
+        if err := flushMonth(&days, fn); err != nil {
+          return err
+        }
+
+        month = rec.Month
+        for i := range days {
+          days[i] = coriolis.Summary{
+            Station: station,
+            Day:     time.Date(year, time.Month(month), i+1, 0, 0, 0, 0, time.UTC),
+          }
+        }
+      }
+
+      for i := range rec.Values {
+        v := &rec.Values[i]
+        if v.Missing() || (v.Failed() && !keepSuspect) {
+          continue
+        }
+        setElement(&days[i], rec.Element, v)
+      }
+      return nil
+    }); err != nil {
+    return err
+  }
+
+  return flushMonth(&days, fn)
+}
+
+// The path of the .dly file for a station.
+func (s *Store) dailyFileFor(station *coriolis.Station) string {
+  return filepath.Join(s.Dir, DailyDir, station.Ghcn+".dly")
+}
+
+// Iterate over the summaries of every station for the given year, to
+// satisfy coriolis.Source. Stations that didn't report temperature that year
+// or that lack a .dly file are skipped. Only the lines of the year are read,
+// using the index of each file. Line numbers in errors count from the year's
+// first line.
+func (s *Store) ForEachSummaryInYear(year int, fn func(s *coriolis.Summary) error) error {
+  for _, station := range s.Stations {
+    if !station.ActiveIn(year) {
+      continue
+    }
+
+    filename := s.dailyFileFor(station)
+    x, err := s.indexFor(station)
+    if err != nil {
+      return fmt.Errorf("%s:%s", filename, err)
+    }
+
+    yr := x[year]
+    if yr == nil {
+      continue
+    }
+
+    r, err := os.Open(filename)
+    if err != nil {
+      return err
+    }
+
+    err = ForEachSummary(io.NewSectionReader(r, yr.Offset, yr.Size), station, year, s.KeepSuspect, fn)
+    r.Close()
+    if err != nil {
+      return fmt.Errorf("%s:%s", filename, err)
+    }
+  }
+
+  return nil
+}
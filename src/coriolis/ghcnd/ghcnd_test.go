@@ -0,0 +1,220 @@
+package ghcnd
+
+import (
+  "bytes"
+  "coriolis"
+  "io/ioutil"
+  "math"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "testing"
+)
+
+func near(a, b float64) bool {
+  return math.Abs(a-b) < 1e-6
+}
+
+func TestLoadStations(t *testing.T) {
+  stations, err := LoadStations("testdata", func(s *coriolis.Station) bool {
+    return true
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if len(stations) != 5 {
+    t.Fatalf("expected 5 stations, got %d", len(stations))
+  }
+
+  s := stations[3]
+  if s.Id() != "USW00023062" || s.Wban != "23062" || s.Country != "US" || s.State != "CO" ||
+    s.Name != "DENVER STAPLETON" {
+    t.Errorf("bad station: %+v", s)
+  }
+
+  if s.Lat != 39.7633 || s.Lon != -104.8694 || !s.HasElev || s.Elev != 1611.1 {
+    t.Errorf("bad location: %v, %v, %v", s.Lat, s.Lon, s.Elev)
+  }
+
+  if s := stations[2]; s.Wban != "" {
+    t.Errorf("expected no wban for a coop station, got %s", s.Wban)
+  }
+
+  store, err := OpenStore("testdata", []int{2013})
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  // canada & alaska are left out, as is a station with only precipitation.
+  if len(store.Stations) != 2 || store.StationIndex["USW00094728"] == nil ||
+    store.StationIndex["USC00051660"] != nil {
+    t.Fatalf("expected 2 stations, got %d", len(store.Stations))
+  }
+
+  // the dates come from the years temperature was reported.
+  s = store.StationIndex["USW00023062"]
+  if s.Begin.Year() != 1948 || s.End.Year() != 1995 || s.ActiveIn(2013) {
+    t.Errorf("expected 1948-1995, got %s-%s", s.Begin, s.End)
+  }
+}
+
+func TestParseRecord(t *testing.T) {
+  r, err := os.Open(filepath.Join("testdata", DailyDir, "USW00094728.dly"))
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer r.Close()
+
+  var recs []Record
+  if err := ForEachRecord(r, nil, func(r *Record) error {
+    recs = append(recs, *r)
+    return nil
+  }); err != nil {
+    t.Fatal(err)
+  }
+
+  if len(recs) != 8 {
+    t.Fatalf("expected 8 records, got %d", len(recs))
+  }
+
+  rec := &recs[1]
+  if rec.Id != "USW00094728" || rec.Year != 2013 || rec.Month != 1 || rec.Element != "TMAX" {
+    t.Errorf("bad record: %s %d %d %s", rec.Id, rec.Year, rec.Month, rec.Element)
+  }
+
+  if v := rec.Values[0]; v.Value != 50 || v.Failed() || v.SFlag != 'X' {
+    t.Errorf("bad value: %+v", v)
+  }
+
+  if v := rec.Values[1]; v.Value != 400 || !v.Failed() || v.QFlag != 'I' {
+    t.Errorf("expected a failed value, got %+v", v)
+  }
+
+  if v := rec.Values[2]; v.Value != -22 || v.MFlag != 'H' {
+    t.Errorf("bad value: %+v", v)
+  }
+
+  if v := rec.Values[3]; !v.Missing() {
+    t.Errorf("expected a missing value, got %+v", v)
+  }
+
+  if err := ParseRecord("USW00094728201301TMAX   50", &recs[0]); err == nil {
+    t.Error("expected an error for a short line")
+  }
+}
+
+// Read all of the summaries for 2013 from the fixtures.
+func readSummaries(t *testing.T, keepSuspect bool) []coriolis.Summary {
+  store, err := OpenStore("testdata", []int{2013})
+  if err != nil {
+    t.Fatal(err)
+  }
+  store.KeepSuspect = keepSuspect
+
+  var days []coriolis.Summary
+  if err := store.ForEachSummaryInYear(2013, func(s *coriolis.Summary) error {
+    days = append(days, *s)
+    return nil
+  }); err != nil {
+    t.Fatal(err)
+  }
+  return days
+}
+
+func TestForEachSummaryInYear(t *testing.T) {
+  // Jan 4, with only precipitation, is left out.
+  days := readSummaries(t, false)
+  if len(days) != 4 {
+    t.Fatalf("expected 4 days, got %d", len(days))
+  }
+
+  s := &days[0]
+  if s.Station.Id() != "USW00094728" || s.Day.Month() != 1 || s.Day.Day() != 1 {
+    t.Errorf("expected USW00094728 on Jan 1, got %s on %s", s.Station.Id(), s.Day)
+  }
+
+  if !s.Has(coriolis.FieldTempMax|coriolis.FieldTempMin|coriolis.FieldTempAvg|
+    coriolis.FieldPrecip|coriolis.FieldSnowDepth) || s.Suspect != 0 {
+    t.Errorf("unexpected fields: %b (%b)", s.Valid, s.Suspect)
+  }
+
+  if !near(s.TempMax, 41) || !near(s.TempMin, 30.02) || !near(s.TempAvg, 35.51) {
+    t.Errorf("unexpected temps: %v %v %v", s.TempMax, s.TempMin, s.TempAvg)
+  }
+
+  if s.Precip != 0 || !s.PrecipComplete() || s.PrecipFlag != 'G' {
+    t.Errorf("unexpected precip: %v %c", s.Precip, s.PrecipFlag)
+  }
+
+  // the max failed its quality check.
+  s = &days[1]
+  if s.Has(coriolis.FieldTempMax) || s.Has(coriolis.FieldTempAvg) || !near(s.TempMin, 23) {
+    t.Errorf("expected only a min, got %b: %v", s.Valid, s.TempMin)
+  }
+
+  s = &days[2]
+  if !s.TempMaxDerived || s.TempMinDerived {
+    t.Errorf("expected the max to be derived")
+  }
+
+  if !near(s.Precip, 0.5) || s.PrecipFlag != 'F' || !near(s.SnowDepth, 10) {
+    t.Errorf("unexpected precip & snow: %v %c %v", s.Precip, s.PrecipFlag, s.SnowDepth)
+  }
+
+  if !s.Had(coriolis.EventThunder) || s.Had(coriolis.EventRain) {
+    t.Errorf("unexpected events: %b", s.Events)
+  }
+
+  s = &days[3]
+  if s.Day.Month() != 2 || s.Day.Day() != 28 || !near(s.TempMax, 60.08) || !near(s.TempMin, 42.98) {
+    t.Errorf("unexpected day: %s %v %v", s.Day, s.TempMax, s.TempMin)
+  }
+}
+
+func TestKeepSuspect(t *testing.T) {
+  days := readSummaries(t, true)
+  if len(days) != 4 {
+    t.Fatalf("expected 4 days, got %d", len(days))
+  }
+
+  s := &days[1]
+  if !s.Has(coriolis.FieldTempMax|coriolis.FieldTempAvg) || !near(s.TempMax, 104) {
+    t.Errorf("expected the suspect max to be kept, got %b: %v", s.Valid, s.TempMax)
+  }
+
+  if s.Suspect != coriolis.FieldTempMax|coriolis.FieldTempAvg {
+    t.Errorf("expected max & avg to be suspect, got %b", s.Suspect)
+  }
+}
+
+func TestBuildIndex(t *testing.T) {
+  b, err := ioutil.ReadFile(filepath.Join("testdata", DailyDir, "USW00094728.dly"))
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  x, err := BuildIndex(bytes.NewReader(b))
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if len(x) != 2 || x[2012] == nil || x[2013] == nil {
+    t.Fatalf("expected 2012 & 2013, got %v", x)
+  }
+
+  // each year's range holds exactly its own lines.
+  for year, yr := range x {
+    lines := strings.Split(strings.TrimSpace(string(b[yr.Offset:yr.Offset+yr.Size])), "\n")
+    for _, l := range lines {
+      if l[11:15] != strconv.Itoa(year) {
+        t.Errorf("%d: unexpected line %q", year, l[:21])
+      }
+    }
+  }
+
+  if x[2012].Offset != 0 || x[2013].Offset != x[2012].Size || x[2013].Offset+x[2013].Size != int64(len(b)) {
+    t.Errorf("unexpected ranges: %+v %+v", x[2012], x[2013])
+  }
+}
@@ -0,0 +1,91 @@
+package ghcnd
+
+import (
+  "bufio"
+  "coriolis"
+  "io"
+  "os"
+  "strconv"
+  "sync"
+)
+
+// The lines of a single year within a .dly file.
+type YearRange struct {
+  Offset int64
+  Size   int64
+}
+
+// The lines of each year within a .dly file. The lines of a file are ordered
+// by year, so each year's lines are contiguous.
+type Index map[int]*YearRange
+
+// Build the index of a .dly file in a single pass.
+func BuildIndex(r io.Reader) (Index, error) {
+  x := Index{}
+  br := bufio.NewReader(r)
+  var off int64
+  for {
+    l, err := br.ReadString('\n')
+    if len(l) >= 15 {
+      year, perr := strconv.Atoi(l[11:15])
+      if perr != nil {
+        return nil, perr
+      }
+
+      // should a year not be contiguous, its range covers the lines of other
+      // years too, which are skipped when reading.
+      if yr := x[year]; yr == nil {
+        x[year] = &YearRange{Offset: off, Size: int64(len(l))}
+      } else {
+        yr.Size = off + int64(len(l)) - yr.Offset
+      }
+    }
+    off += int64(len(l))
+
+    if err == io.EOF {
+      return x, nil
+    } else if err != nil {
+      return nil, err
+    }
+  }
+}
+
+// The index of a single station's file, built the first time it is needed.
+type stationIndex struct {
+  once sync.Once
+  x    Index
+  err  error
+}
+
+// Get the index of a station's .dly file, building it the first time it is
+// needed. Each file is scanned only once however many years are read from it.
+// The index is nil when the station has no .dly file.
+func (s *Store) indexFor(station *coriolis.Station) (Index, error) {
+  s.lck.Lock()
+  if s.indexes == nil {
+    s.indexes = map[*coriolis.Station]*stationIndex{}
+  }
+  si := s.indexes[station]
+  if si == nil {
+    si = &stationIndex{}
+    s.indexes[station] = si
+  }
+  s.lck.Unlock()
+
+  // the file is scanned without holding the store's lock, so other stations
+  // are indexed concurrently.
+  si.once.Do(func() {
+    r, err := os.Open(s.dailyFileFor(station))
+    if os.IsNotExist(err) {
+      return
+    } else if err != nil {
+      si.err = err
+      return
+    }
+    defer r.Close()
+
+    si.x, si.err = BuildIndex(r)
+  })
+
+  return si.x, si.err
+}
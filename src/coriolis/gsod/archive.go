@@ -0,0 +1,187 @@
+package gsod
+
+import (
+  "archive/tar"
+  "compress/gzip"
+  "coriolis"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "regexp"
+  "strconv"
+  "strings"
+)
+
+// The ways a year of GSOD data may be laid out in the data directory, in order
+// of preference. The legacy gsod_YYYY.tar holds gzipped fixed-width .op files;
+// NOAA now also publishes YYYY.tar.gz bundles of per-station CSV files and the
+// CSV files themselves, which can be kept in a directory named for the year.
+var archivePatterns = []struct {
+  re  *regexp.Regexp
+  dir bool
+}{
+  {regexp.MustCompile(`^gsod_(\d{4})\.tar$`), false},
+  {regexp.MustCompile(`^(?:gsod_)?(\d{4})\.tar\.gz$`), false},
+  {regexp.MustCompile(`^(?:gsod_)?(\d{4})$`), true},
+}
+
+// Find the archive of each year in dir.
+func findArchives(dir string) (map[int]string, error) {
+  files, err := ioutil.ReadDir(dir)
+  if err != nil {
+    return nil, err
+  }
+
+  archives := map[int]string{}
+  for _, pat := range archivePatterns {
+    for _, fi := range files {
+      m := pat.re.FindStringSubmatch(fi.Name())
+      if m == nil || fi.IsDir() != pat.dir {
+        continue
+      }
+
+      yr, err := strconv.ParseInt(m[1], 10, 64)
+      if err != nil {
+        return nil, err
+      }
+
+      if _, ok := archives[int(yr)]; !ok {
+        archives[int(yr)] = filepath.Join(dir, fi.Name())
+      }
+    }
+  }
+
+  return archives, nil
+}
+
+// Whether the members of the archive can be read directly from their offsets
+// in the file, which is only true of uncompressed tars.
+func isSeekable(archive string) bool {
+  return strings.HasSuffix(archive, ".tar")
+}
+
+// Call fn with each of the station files in an archive, which is a tar, a
+// gzipped tar or a directory. Only the files for which want returns true are
+// read.
+func forEachMember(archive string, want func(name string) bool, fn func(r io.Reader, name string) error) error {
+  fi, err := os.Stat(archive)
+  if err != nil {
+    return err
+  }
+
+  if fi.IsDir() {
+    files, err := ioutil.ReadDir(archive)
+    if err != nil {
+      return err
+    }
+
+    for _, f := range files {
+      if f.IsDir() || !want(f.Name()) {
+        continue
+      }
+
+      if err := forFile(filepath.Join(archive, f.Name()), func(r io.Reader) error {
+        return fn(r, f.Name())
+      }); err != nil {
+        return err
+      }
+    }
+    return nil
+  }
+
+  return forFile(archive, func(r io.Reader) error {
+    if strings.HasSuffix(archive, ".gz") {
+      gr, err := gzip.NewReader(r)
+      if err != nil {
+        return err
+      }
+      r = gr
+    }
+
+    tr := tar.NewReader(r)
+    for {
+      // advance the tar to the next entry
+      h, err := tr.Next()
+      if err == io.EOF {
+        return nil
+      } else if err != nil {
+        return err
+      }
+
+      // directory entries for . and .. are included, ignore those
+      if h.FileInfo().IsDir() || !want(h.Name) {
+        continue
+      }
+
+      if err := fn(tr, h.Name); err != nil {
+        return err
+      }
+    }
+  })
+}
+
+// Open the file and call fn with its contents.
+func forFile(filename string, fn func(r io.Reader) error) error {
+  r, err := os.Open(filename)
+  if err != nil {
+    return err
+  }
+  defer r.Close()
+
+  return fn(r)
+}
+
+// A format in which the summaries of a station are published.
+type format interface {
+  // Read each of the summaries in r, which came from member of the archive
+  // filename, calling fn for those of known stations and bad for any that are
+  // malformed.
+  forEachSummary(
+    r io.Reader,
+    filename, member string,
+    stations map[string]*coriolis.Station,
+    s *coriolis.Summary,
+    fn func(s *coriolis.Summary) error,
+    bad func(err *ParseError) error) error
+}
+
+// Determine the format of a station file from its name and whether it is
+// compressed with gzip. The format is nil for files that are not station
+// data.
+func formatOf(name string) (format, bool) {
+  gz := strings.HasSuffix(name, ".gz")
+  switch filepath.Ext(strings.TrimSuffix(name, ".gz")) {
+  case ".op":
+    return opFormat{}, gz
+  case ".csv":
+    return csvFormat{}, gz
+  }
+  return nil, false
+}
+
+// Read all of the summaries in a single member of an archive, in whichever
+// format it happens to be.
+func forEachSummaryInMember(
+  r io.Reader,
+  filename, member string,
+  stations map[string]*coriolis.Station,
+  s *coriolis.Summary,
+  fn func(s *coriolis.Summary) error,
+  bad func(err *ParseError) error) error {
+  f, gz := formatOf(member)
+  if f == nil {
+    return nil
+  }
+
+  if gz {
+    gr, err := gzip.NewReader(r)
+    if err != nil {
+      return fmt.Errorf("%s:%s: %s", filename, member, err)
+    }
+    r = gr
+  }
+
+  return f.forEachSummary(r, filename, member, stations, s, fn, bad)
+}
@@ -0,0 +1,218 @@
+package gsod
+
+import (
+  "coriolis"
+  "encoding/csv"
+  "fmt"
+  "io"
+  "strings"
+  "time"
+)
+
+// The per-station CSV format NOAA publishes GSOD in, which has named columns
+// and carries the observation counts and flags in *_ATTRIBUTES columns.
+type csvFormat struct{}
+
+// A value column along with the sentinel for missing values and, if there is
+// one, its observation count column.
+type csvValue struct {
+  name    string
+  missing float64
+  field   coriolis.Field
+  value   func(s *coriolis.Summary) *float64
+  count   func(s *coriolis.Summary) *int
+}
+
+var csvValues = []csvValue{
+  {"TEMP", 9999.9, coriolis.FieldTempAvg,
+    func(s *coriolis.Summary) *float64 { return &s.TempAvg },
+    func(s *coriolis.Summary) *int { return &s.TempAvgCount }},
+  {"DEWP", 9999.9, coriolis.FieldDewPoint,
+    func(s *coriolis.Summary) *float64 { return &s.DewPoint },
+    func(s *coriolis.Summary) *int { return &s.DewPointCount }},
+  {"SLP", 9999.9, coriolis.FieldSeaLevelPressure,
+    func(s *coriolis.Summary) *float64 { return &s.SeaLevelPressure },
+    func(s *coriolis.Summary) *int { return &s.SeaLevelPressureCount }},
+  {"STP", 9999.9, coriolis.FieldStationPressure,
+    func(s *coriolis.Summary) *float64 { return &s.StationPressure },
+    func(s *coriolis.Summary) *int { return &s.StationPressureCount }},
+  {"VISIB", 999.9, coriolis.FieldVisibility,
+    func(s *coriolis.Summary) *float64 { return &s.Visibility },
+    func(s *coriolis.Summary) *int { return &s.VisibilityCount }},
+  {"WDSP", 999.9, coriolis.FieldWindAvg,
+    func(s *coriolis.Summary) *float64 { return &s.WindAvg },
+    func(s *coriolis.Summary) *int { return &s.WindAvgCount }},
+  {"MXSPD", 999.9, coriolis.FieldWindMax,
+    func(s *coriolis.Summary) *float64 { return &s.WindMax }, nil},
+  {"GUST", 999.9, coriolis.FieldGust,
+    func(s *coriolis.Summary) *float64 { return &s.Gust }, nil},
+  {"MAX", 9999.9, coriolis.FieldTempMax,
+    func(s *coriolis.Summary) *float64 { return &s.TempMax }, nil},
+  {"MIN", 9999.9, coriolis.FieldTempMin,
+    func(s *coriolis.Summary) *float64 { return &s.TempMin }, nil},
+  {"PRCP", 99.99, coriolis.FieldPrecip,
+    func(s *coriolis.Summary) *float64 { return &s.Precip }, nil},
+  {"SNDP", 999.9, coriolis.FieldSnowDepth,
+    func(s *coriolis.Summary) *float64 { return &s.SnowDepth }, nil},
+}
+
+// The columns of a CSV file, by name.
+type csvColumns map[string]int
+
+// The value of the named column in v, which is empty if there is no such column.
+func (c csvColumns) get(v []string, name string) (string, int) {
+  i, ok := c[name]
+  if !ok || i >= len(v) {
+    return "", -1
+  }
+  return v[i], i
+}
+
+// Convert the station id in the CSV (USAF followed by WBAN) to the usual form.
+func csvStationId(s string) (string, error) {
+  s = strings.TrimSpace(s)
+  if len(s) != 11 {
+    return "", fmt.Errorf("invalid station: %q", s)
+  }
+  return s[:6] + "-" + s[6:], nil
+}
+
+// Parse a single CSV record into s. Along with any error, this returns the index
+// of the offending field.
+func (c csvColumns) toSummary(s *coriolis.Summary, station *coriolis.Station, v []string) (int, error) {
+  s.Station = station
+  s.Valid = 0
+
+  date, i := c.get(v, "DATE")
+  day, err := time.Parse("2006-01-02", strings.TrimSpace(date))
+  if err != nil {
+    return i, err
+  }
+  s.Day = day
+
+  for _, cv := range csvValues {
+    val, i := c.get(v, cv.name)
+    if i < 0 {
+      *cv.value(s) = 0
+    } else if err := valueOf(val, cv.missing, cv.field, cv.value(s), &s.Valid); err != nil {
+      return i, err
+    }
+
+    if cv.count != nil {
+      cnt, i := c.get(v, cv.name+"_ATTRIBUTES")
+      if err := countOf(cnt, cv.count(s)); err != nil {
+        return i, err
+      }
+    }
+  }
+
+  max, _ := c.get(v, "MAX_ATTRIBUTES")
+  s.TempMaxDerived = strings.TrimSpace(max) == "*"
+
+  min, _ := c.get(v, "MIN_ATTRIBUTES")
+  s.TempMinDerived = strings.TrimSpace(min) == "*"
+
+  flag, i := c.get(v, "PRCP_ATTRIBUTES")
+  flag = strings.TrimSpace(flag)
+  if flag == "" {
+    flag = " "
+  }
+  if len(flag) != 1 {
+    return i, fmt.Errorf("invalid PRCP flag: %q", flag)
+  }
+  if err := setPrecipFlag(s, flag[0]); err != nil {
+    return i, err
+  }
+
+  // the indicators are sometimes written as a number, losing leading zeros.
+  events, i := c.get(v, "FRSHTT")
+  s.Events = 0
+  if events = strings.TrimSpace(events); events != "" {
+    if len(events) < 6 {
+      events = strings.Repeat("0", 6-len(events)) + events
+    }
+
+    if err := eventsOf(events, &s.Events); err != nil {
+      return i, err
+    }
+  }
+
+  return -1, nil
+}
+
+func (csvFormat) forEachSummary(
+  r io.Reader,
+  filename, member string,
+  stations map[string]*coriolis.Station,
+  s *coriolis.Summary,
+  fn func(s *coriolis.Summary) error,
+  bad func(err *ParseError) error) error {
+  cr := csv.NewReader(r)
+  cr.FieldsPerRecord = -1
+
+  header, err := cr.Read()
+  if err == io.EOF {
+    return nil
+  } else if err != nil {
+    return fmt.Errorf("%s:%s: %s", filename, member, err)
+  }
+
+  c := csvColumns{}
+  for i, name := range header {
+    c[strings.ToUpper(strings.TrimSpace(name))] = i
+  }
+
+  if _, ok := c["STATION"]; !ok {
+    return fmt.Errorf("%s:%s: no STATION column", filename, member)
+  }
+
+  if _, ok := c["DATE"]; !ok {
+    return fmt.Errorf("%s:%s: no DATE column", filename, member)
+  }
+
+  for {
+    v, err := cr.Read()
+    if err == io.EOF {
+      return nil
+    } else if err != nil {
+      return fmt.Errorf("%s:%s: %s", filename, member, err)
+    }
+
+    val, i := c.get(v, "STATION")
+    id, err := csvStationId(val)
+    if err == nil {
+      station := stations[id]
+      if station == nil {
+        continue
+      }
+      i, err = c.toSummary(s, station, v)
+    }
+
+    if err != nil {
+      line, _ := cr.FieldPos(0)
+      pe := &ParseError{
+        File:   filename,
+        Member: member,
+        Line:   line,
+        Text:   strings.Join(v, ","),
+        Err:    err,
+      }
+
+      // the range is the field's columns within the line.
+      if i >= 0 {
+        _, col := cr.FieldPos(i)
+        pe.Begin = col - 1
+        pe.End = pe.Begin + len(v[i])
+      }
+
+      if err := bad(pe); err != nil {
+        return err
+      }
+      continue
+    }
+
+    if err := fn(s); err != nil {
+      return err
+    }
+  }
+}
@@ -0,0 +1,184 @@
+package gsod
+
+import (
+  "archive/tar"
+  "bytes"
+  "compress/gzip"
+  "coriolis"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+const testCsv = `"STATION","DATE","LATITUDE","LONGITUDE","ELEVATION","NAME","TEMP","TEMP_ATTRIBUTES","DEWP","DEWP_ATTRIBUTES","SLP","SLP_ATTRIBUTES","STP","STP_ATTRIBUTES","VISIB","VISIB_ATTRIBUTES","WDSP","WDSP_ATTRIBUTES","MXSPD","GUST","MAX","MAX_ATTRIBUTES","MIN","MIN_ATTRIBUTES","PRCP","PRCP_ATTRIBUTES","SNDP","FRSHTT"
+"72503014732","2013-01-01","40.7794","-73.88","3.4","LAGUARDIA AIRPORT, NY US","  34.8","24","  21.0","24","1016.5","24","1015.8","24","  10.0","24","  11.6","24","  19.0","  28.0","  41.0","*","  28.9"," ","  0.00","G","999.9","000000"
+"72503014732","2013-01-02","40.7794","-73.88","3.4","LAGUARDIA AIRPORT, NY US","  34.8","24","  21.0","24","1016.5","24","1015.8","24","  10.0","24","  11.6","24","  19.0","  28.0","  41.0","*","  28.9"," ","  0.12","I","999.9","10010"
+`
+
+func TestCsvSummary(t *testing.T) {
+  a := &coriolis.Station{Usaf: "725030", Wban: "14732"}
+
+  var op coriolis.Summary
+  if err := toSummary(&op, a, testLine); err != nil {
+    t.Fatal(err)
+  }
+
+  var days []coriolis.Summary
+  if err := (csvFormat{}).forEachSummary(
+    strings.NewReader(testCsv), "test", "72503014732.csv",
+    map[string]*coriolis.Station{a.Id(): a},
+    &coriolis.Summary{},
+    func(s *coriolis.Summary) error {
+      days = append(days, *s)
+      return nil
+    },
+    func(err *ParseError) error {
+      return err
+    }); err != nil {
+    t.Fatal(err)
+  }
+
+  if len(days) != 2 {
+    t.Fatalf("expected 2 days, got %d", len(days))
+  }
+
+  // the first day is the same as the fixed-width test line.
+  if days[0] != op {
+    t.Errorf("expected %+v, got %+v", op, days[0])
+  }
+
+  s := &days[1]
+  if s.Has(coriolis.FieldPrecip) || s.PrecipFlag != 'I' {
+    t.Errorf("expected precip to be missing, got %v %c", s.Precip, s.PrecipFlag)
+  }
+
+  if !s.Had(coriolis.EventRain|coriolis.EventThunder) || s.Had(coriolis.EventFog) {
+    t.Errorf("unexpected events: %b", s.Events)
+  }
+}
+
+func TestCsvParseError(t *testing.T) {
+  a := &coriolis.Station{Usaf: "725030", Wban: "14732"}
+  in := strings.Replace(testCsv, `"2013-01-02"`, `"2013-01-0x"`, 1)
+
+  var pe *ParseError
+  n := 0
+  if err := (csvFormat{}).forEachSummary(
+    strings.NewReader(in), "test", "72503014732.csv",
+    map[string]*coriolis.Station{a.Id(): a},
+    &coriolis.Summary{},
+    func(s *coriolis.Summary) error {
+      n++
+      return nil
+    },
+    func(err *ParseError) error {
+      pe = err
+      return nil
+    }); err != nil {
+    t.Fatal(err)
+  }
+
+  if n != 1 {
+    t.Errorf("expected 1 good day, got %d", n)
+  }
+
+  if pe == nil || pe.Line != 3 || pe.Begin != 14 || pe.End != 24 {
+    t.Errorf("unexpected error: %v", pe)
+  }
+}
+
+// Write the CSV as a member of a YYYY.tar.gz
+func writeCsvArchive(t *testing.T, filename string, members map[string]string) {
+  var buf bytes.Buffer
+  gw := gzip.NewWriter(&buf)
+  tw := tar.NewWriter(gw)
+  for name, data := range members {
+    if err := tw.WriteHeader(&tar.Header{
+      Name: name,
+      Mode: 0644,
+      Size: int64(len(data)),
+    }); err != nil {
+      t.Fatal(err)
+    }
+
+    if _, err := tw.Write([]byte(data)); err != nil {
+      t.Fatal(err)
+    }
+  }
+  tw.Close()
+  gw.Close()
+
+  if err := ioutil.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+    t.Fatal(err)
+  }
+}
+
+func TestCsvStore(t *testing.T) {
+  dir, err := ioutil.TempDir("", "gsod")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+
+  writeArchive(t, filepath.Join(dir, "gsod_2012.tar"), map[string][]string{
+    "./725030-14732-2012.op.gz": []string{"725030 14732  2012" + testLine[18:]},
+  })
+
+  writeCsvArchive(t, filepath.Join(dir, "2013.tar.gz"), map[string]string{
+    "72503014732.csv": testCsv,
+  })
+
+  if err := os.Mkdir(filepath.Join(dir, "2014"), 0755); err != nil {
+    t.Fatal(err)
+  }
+
+  if err := ioutil.WriteFile(filepath.Join(dir, "2014", "72503014732.csv"),
+    []byte(strings.Replace(testCsv, "2013-", "2014-", -1)), 0644); err != nil {
+    t.Fatal(err)
+  }
+
+  a := &coriolis.Station{Usaf: "725030", Wban: "14732"}
+  s, err := NewStore(&coriolis.Store{
+    Dir:          dir,
+    Stations:     []*coriolis.Station{a},
+    StationIndex: map[string]*coriolis.Station{a.Id(): a},
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if len(s.Years) != 3 || s.Years[0] != 2012 || s.Years[2] != 2014 {
+    t.Fatalf("expected years 2012-2014, got %v", s.Years)
+  }
+
+  for _, year := range s.Years {
+    n := 0
+    if err := s.ForEachSummaryInYear(year, func(s *coriolis.Summary) error {
+      if s.Day.Year() != year {
+        t.Errorf("expected %d, got %s", year, s.Day)
+      }
+      n++
+      return nil
+    }); err != nil {
+      t.Fatal(err)
+    }
+
+    if year > 2012 && n != 2 {
+      t.Errorf("%d: expected 2 days, got %d", year, n)
+    }
+  }
+
+  n := 0
+  if err := s.ForEachSummaryForStation(a.Id(), s.Years, func(s *coriolis.Summary) error {
+    n++
+    return nil
+  }); err != nil {
+    t.Fatal(err)
+  }
+
+  if n != 5 {
+    t.Errorf("expected 5 days, got %d", n)
+  }
+}
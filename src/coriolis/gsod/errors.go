@@ -0,0 +1,99 @@
+package gsod
+
+import (
+  "fmt"
+  "sort"
+)
+
+// The number of errors retained for each file in lenient mode.
+const maxErrorsPerFile = 10
+
+// An error describing a malformed record in a GSOD archive.
+type ParseError struct {
+  // The archive (a tar or a directory) and the member within it.
+  File   string
+  Member string
+
+  // The 1-based line number within the member.
+  Line int
+
+  // The 0-based column range [Begin, End) of the offending field.
+  Begin int
+  End   int
+
+  // The raw text of the line.
+  Text string
+
+  Err error
+}
+
+func columnError(b, e int, err error) error {
+  return &ParseError{
+    Begin: b,
+    End:   e,
+    Err:   err,
+  }
+}
+
+func (e *ParseError) Error() string {
+  return fmt.Sprintf("%s:%s:%d:%d-%d: %s", e.File, e.Member, e.Line, e.Begin, e.End, e.Err)
+}
+
+// A summary of the malformed records skipped within a single archive member.
+type FileErrors struct {
+  File   string
+  Member string
+
+  // The total number of records skipped.
+  Count int
+
+  // The first few errors, up to maxErrorsPerFile.
+  Errors []*ParseError
+
+  // the lines already counted, a member may be read more than once.
+  lines map[int]bool
+}
+
+// Accumulates FileErrors keyed by archive and member.
+type errorLog map[string]*FileErrors
+
+func (l *errorLog) add(err *ParseError) {
+  if *l == nil {
+    *l = errorLog{}
+  }
+
+  key := err.File + ":" + err.Member
+  fe := (*l)[key]
+  if fe == nil {
+    fe = &FileErrors{
+      File:   err.File,
+      Member: err.Member,
+      lines:  map[int]bool{},
+    }
+    (*l)[key] = fe
+  }
+
+  if fe.lines[err.Line] {
+    return
+  }
+  fe.lines[err.Line] = true
+
+  fe.Count++
+  if len(fe.Errors) < maxErrorsPerFile {
+    fe.Errors = append(fe.Errors, err)
+  }
+}
+
+func (l errorLog) list() []*FileErrors {
+  keys := make([]string, 0, len(l))
+  for k, _ := range l {
+    keys = append(keys, k)
+  }
+  sort.Strings(keys)
+
+  res := make([]*FileErrors, 0, len(keys))
+  for _, k := range keys {
+    res = append(res, l[k])
+  }
+  return res
+}
@@ -1,179 +1,377 @@
 package gsod
 
 import (
-  "archive/tar"
   "bufio"
   "bytes"
-  "compress/gzip"
   "coriolis"
   "fmt"
   "io"
-  "os"
   "path/filepath"
   "sort"
   "strconv"
   "strings"
+  "sync"
   "time"
 )
 
 type Store struct {
   *coriolis.Store
   Years []int
-}
 
-type Summary struct {
-  Station   *coriolis.Station
-  Day       time.Time
-  WindAvg   float64
-  WindMax   float64
-  TempAvg   float64
-  TempMax   float64
-  TempMin   float64
-  Precip    float64
-  SnowDepth float64
+  // When set, malformed records are skipped and recorded (see Errors)
+  // instead of aborting the iteration.
+  Lenient bool
+
+  lck      sync.Mutex
+  errors   errorLog
+  indexes  map[int]Index
+  archives map[int]string
 }
 
+// The length of a complete line in a GSOD file.
+const lineLength = 138
+
 func toStationId(l string) string {
   return fmt.Sprintf("%s-%s", l[0:6], l[7:12])
 }
 
-func toSummary(s *Summary, station *coriolis.Station, l string) error {
-  s.Station = station
-
-  yr, err := strconv.ParseInt(l[14:18], 10, 32)
+// Parse the float value in s into v. If the value matches the missing sentinel,
+// v is set to zero and f is left out of the valid set.
+func valueOf(s string, missing float64, f coriolis.Field, v *float64, valid *coriolis.Field) error {
+  *v = 0
+  n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
   if err != nil {
     return err
   }
 
-  mn, err := strconv.ParseInt(l[18:20], 10, 32)
+  if n == missing {
+    return nil
+  }
+
+  *v = n
+  *valid |= f
+  return nil
+}
+
+// Parse the observation count in s into v. Blank counts are zero.
+func countOf(s string, v *int) error {
+  *v = 0
+  s = strings.TrimSpace(s)
+  if s == "" {
+    return nil
+  }
+
+  n, err := strconv.ParseInt(s, 10, 32)
   if err != nil {
     return err
   }
 
-  dy, err := strconv.ParseInt(l[20:22], 10, 32)
+  *v = int(n)
+  return nil
+}
+
+// Parse the FRSHTT indicators in s, which is a string of six 0/1 characters.
+func eventsOf(s string, v *coriolis.Event) error {
+  *v = 0
+  if len(s) != 6 {
+    return fmt.Errorf("invalid FRSHTT indicator: %q", s)
+  }
+
+  for i, c := range s {
+    switch c {
+    case '1':
+      *v |= 1 << uint(i)
+    case '0':
+    default:
+      return fmt.Errorf("invalid FRSHTT indicator: %q", s)
+    }
+  }
+  return nil
+}
+
+// Set the precipitation attribute flag of s.
+func setPrecipFlag(s *coriolis.Summary, flag byte) error {
+  s.PrecipFlag = flag
+  switch flag {
+  case ' ', 'A', 'B', 'C', 'D', 'E', 'F', 'G', 'H':
+  case 'I':
+    // I indicates that no precipitation was reported at all, so the
+    // value is not meaningful.
+    s.Precip = 0
+    s.Valid &^= coriolis.FieldPrecip
+  default:
+    return fmt.Errorf("invalid PRCP flag: %q", flag)
+  }
+  return nil
+}
+
+// Parse the fixed-width float value in columns [b,e) of l into v, see valueOf.
+func parseValue(l string, b, e int, missing float64, f coriolis.Field, v *float64, valid *coriolis.Field) error {
+  if err := valueOf(l[b:e], missing, f, v, valid); err != nil {
+    return columnError(b, e, err)
+  }
+  return nil
+}
+
+// Parse the fixed-width observation count in columns [b,e) of l into v.
+func parseCount(l string, b, e int, v *int) error {
+  if err := countOf(l[b:e], v); err != nil {
+    return columnError(b, e, err)
+  }
+  return nil
+}
+
+// Parse the FRSHTT columns [b,e) of l.
+func parseEvents(l string, b, e int, v *coriolis.Event) error {
+  if err := eventsOf(l[b:e], v); err != nil {
+    return columnError(b, e, err)
+  }
+  return nil
+}
+
+// Parse the fixed-width integer in columns [b,e) of l.
+func parseInt(l string, b, e int) (int, error) {
+  n, err := strconv.ParseInt(l[b:e], 10, 32)
   if err != nil {
-    return err
+    return 0, columnError(b, e, err)
   }
+  return int(n), nil
+}
 
-  s.Day = time.Date(int(yr), time.Month(int(mn)), int(dy), 0, 0, 0, 0, time.UTC)
+func toSummary(s *coriolis.Summary, station *coriolis.Station, l string) error {
+  if len(l) < lineLength {
+    return columnError(len(l), lineLength,
+      fmt.Errorf("short line: expected %d bytes, got %d", lineLength, len(l)))
+  }
 
-  var tmp float64
-  tmp, err = strconv.ParseFloat(strings.TrimSpace(l[78:83]), 64)
+  s.Station = station
+  s.Valid = 0
+
+  yr, err := parseInt(l, 14, 18)
   if err != nil {
     return err
   }
-  s.WindAvg = tmp
 
-  tmp, err = strconv.ParseFloat(strings.TrimSpace(l[88:93]), 64)
+  mn, err := parseInt(l, 18, 20)
   if err != nil {
     return err
   }
-  s.WindMax = tmp
 
-  tmp, err = strconv.ParseFloat(strings.TrimSpace(l[24:30]), 64)
+  dy, err := parseInt(l, 20, 22)
   if err != nil {
     return err
   }
-  s.TempAvg = tmp
 
-  tmp, err = strconv.ParseFloat(strings.TrimSpace(l[102:108]), 64)
-  if err != nil {
+  s.Day = time.Date(yr, time.Month(mn), dy, 0, 0, 0, 0, time.UTC)
+
+  if err := parseValue(l, 24, 30, 9999.9, coriolis.FieldTempAvg, &s.TempAvg, &s.Valid); err != nil {
     return err
   }
-  s.TempMax = tmp
 
-  tmp, err = strconv.ParseFloat(strings.TrimSpace(l[110:116]), 64)
-  if err != nil {
+  if err := parseCount(l, 31, 33, &s.TempAvgCount); err != nil {
     return err
   }
-  s.TempMin = tmp
 
-  tmp, err = strconv.ParseFloat(strings.TrimSpace(l[118:123]), 64)
-  if err != nil {
+  if err := parseValue(l, 35, 41, 9999.9, coriolis.FieldDewPoint, &s.DewPoint, &s.Valid); err != nil {
     return err
   }
-  s.Precip = tmp
 
-  tmp, err = strconv.ParseFloat(strings.TrimSpace(l[125:130]), 64)
-  if err != nil {
+  if err := parseCount(l, 42, 44, &s.DewPointCount); err != nil {
+    return err
+  }
+
+  if err := parseValue(l, 46, 52, 9999.9, coriolis.FieldSeaLevelPressure, &s.SeaLevelPressure, &s.Valid); err != nil {
+    return err
+  }
+
+  if err := parseCount(l, 53, 55, &s.SeaLevelPressureCount); err != nil {
+    return err
+  }
+
+  if err := parseValue(l, 57, 63, 9999.9, coriolis.FieldStationPressure, &s.StationPressure, &s.Valid); err != nil {
+    return err
+  }
+
+  if err := parseCount(l, 64, 66, &s.StationPressureCount); err != nil {
+    return err
+  }
+
+  if err := parseValue(l, 68, 73, 999.9, coriolis.FieldVisibility, &s.Visibility, &s.Valid); err != nil {
+    return err
+  }
+
+  if err := parseCount(l, 74, 76, &s.VisibilityCount); err != nil {
+    return err
+  }
+
+  if err := parseValue(l, 78, 83, 999.9, coriolis.FieldWindAvg, &s.WindAvg, &s.Valid); err != nil {
+    return err
+  }
+
+  if err := parseCount(l, 84, 86, &s.WindAvgCount); err != nil {
+    return err
+  }
+
+  if err := parseValue(l, 88, 93, 999.9, coriolis.FieldWindMax, &s.WindMax, &s.Valid); err != nil {
+    return err
+  }
+
+  if err := parseValue(l, 95, 100, 999.9, coriolis.FieldGust, &s.Gust, &s.Valid); err != nil {
+    return err
+  }
+
+  if err := parseValue(l, 102, 108, 9999.9, coriolis.FieldTempMax, &s.TempMax, &s.Valid); err != nil {
+    return err
+  }
+
+  s.TempMaxDerived = l[108] == '*'
+
+  if err := parseValue(l, 110, 116, 9999.9, coriolis.FieldTempMin, &s.TempMin, &s.Valid); err != nil {
+    return err
+  }
+
+  s.TempMinDerived = l[116] == '*'
+
+  if err := parseValue(l, 118, 123, 99.99, coriolis.FieldPrecip, &s.Precip, &s.Valid); err != nil {
+    return err
+  }
+
+  if err := setPrecipFlag(s, l[123]); err != nil {
+    return columnError(123, 124, err)
+  }
+
+  if err := parseValue(l, 125, 130, 999.9, coriolis.FieldSnowDepth, &s.SnowDepth, &s.Valid); err != nil {
+    return err
+  }
+
+  if err := parseEvents(l, 132, 138, &s.Events); err != nil {
     return err
   }
-  s.SnowDepth = tmp
 
   return nil
 }
 
-func (s *Store) ForEachSummaryInYear(year int, f func(s *Summary) error) error {
-  var summary Summary
-  return forEachSummary(
-    filepath.Join(s.Dir, fmt.Sprintf("gsod_%d.tar", year)), s.StationIndex, &summary, f)
+func (s *Store) ForEachSummaryInYear(year int, f func(s *coriolis.Summary) error) error {
+  var summary coriolis.Summary
+  return forEachSummary(s.archiveFor(year), s.StationIndex, &summary, f, s.badRecord)
 }
 
-func forEachSummary(filename string, stations map[string]*coriolis.Station, s *Summary, fn func(s *Summary) error) error {
-  r, err := os.Open(filename)
-  if err != nil {
+// The stations in the store, to satisfy coriolis.Source.
+func (s *Store) StationStore() *coriolis.Store {
+  return s.Store
+}
+
+// The years for which there are archives, to satisfy coriolis.Source.
+func (s *Store) YearRange() []int {
+  return s.Years
+}
+
+// Handles a malformed record. In lenient mode, the error is recorded and
+// iteration continues, otherwise the error aborts the iteration.
+func (s *Store) badRecord(err *ParseError) error {
+  if !s.Lenient {
     return err
   }
-  defer r.Close()
 
-  tr := tar.NewReader(r)
+  s.lck.Lock()
+  defer s.lck.Unlock()
+  s.errors.add(err)
+  return nil
+}
+
+// The per-file summary of the malformed records that were skipped in
+// lenient mode, ordered by archive and member.
+func (s *Store) Errors() []*FileErrors {
+  s.lck.Lock()
+  defer s.lck.Unlock()
+  return s.errors.list()
+}
+
+// The path of the archive for the given year.
+func (s *Store) archiveFor(year int) string {
+  if a, ok := s.archives[year]; ok {
+    return a
+  }
+  return filepath.Join(s.Dir, fmt.Sprintf("gsod_%d.tar", year))
+}
+
+// Read all of the summaries in an archive.
+func forEachSummary(
+  filename string,
+  stations map[string]*coriolis.Station,
+  s *coriolis.Summary,
+  fn func(s *coriolis.Summary) error,
+  bad func(err *ParseError) error) error {
+  return forEachMember(filename,
+    func(name string) bool {
+      return true
+    },
+    func(r io.Reader, name string) error {
+      return forEachSummaryInMember(r, filename, name, stations, s, fn, bad)
+    })
+}
+
+// The legacy fixed-width format of the .op files.
+type opFormat struct{}
+
+func (opFormat) forEachSummary(
+  r io.Reader,
+  filename, member string,
+  stations map[string]*coriolis.Station,
+  s *coriolis.Summary,
+  fn func(s *coriolis.Summary) error,
+  bad func(err *ParseError) error) error {
+  // read each line in the entry
   var buf bytes.Buffer
+  br := bufio.NewReader(r)
+  n := 0
   for {
-    // advance the tar to the next entry
-    h, err := tr.Next()
+    b, p, err := br.ReadLine()
     if err == io.EOF {
       return nil
     } else if err != nil {
       return err
     }
 
-    // directory entries for . and .. are included, ignore those
-    if h.FileInfo().IsDir() {
+    buf.Write(b)
+    if p {
       continue
     }
 
-    // each entry is compressed with gzip
-    gr, err := gzip.NewReader(tr)
-    if err != nil {
-      return err
-    }
-
-    // read each line in the entry
-    br := bufio.NewReader(gr)
-    for {
-      b, p, err := br.ReadLine()
-      if err == io.EOF {
-        break
-      } else if err != nil {
-        return err
-      }
-
-      buf.Write(b)
-      if p {
-        continue
-      }
-
-      // Is this a header?
-      line := buf.String()
-      buf.Reset()
+    // Is this a header?
+    line := buf.String()
+    buf.Reset()
+    n++
 
-      if strings.HasPrefix(line, "STN--- WBAN   YEARMODA") {
-        continue
-      }
+    if strings.HasPrefix(line, "STN--- WBAN   YEARMODA") {
+      continue
+    }
 
-      station := stations[toStationId(line)]
+    var station *coriolis.Station
+    if len(line) >= lineLength {
+      station = stations[toStationId(line)]
       if station == nil {
         continue
       }
+    }
 
-      if err := toSummary(s, station, line); err != nil {
+    if err := toSummary(s, station, line); err != nil {
+      pe, ok := err.(*ParseError)
+      if !ok {
         return err
       }
-
-      if err := fn(s); err != nil {
+      pe.File = filename
+      pe.Member = member
+      pe.Line = n
+      pe.Text = line
+      if err := bad(pe); err != nil {
         return err
       }
+      continue
+    }
 
+    if err := fn(s); err != nil {
+      return err
     }
   }
 }
@@ -187,26 +385,25 @@ func OpenStore(dir string) (*Store, error) {
   return NewStore(s)
 }
 
+// Create a store over the GSOD data in the directory of s. Each year may be
+// either a gsod_YYYY.tar of fixed-width files or per-station CSV files, either
+// bundled as YYYY.tar.gz or in a directory named YYYY.
 func NewStore(s *coriolis.Store) (*Store, error) {
-  files, err := filepath.Glob(filepath.Join(s.Dir, "gsod_*.tar"))
+  archives, err := findArchives(s.Dir)
   if err != nil {
     return nil, err
   }
 
-  years := make([]int, 0, len(files))
-  for _, file := range files {
-    base := filepath.Base(file)
-    yr, err := strconv.ParseInt(base[5:9], 10, 64)
-    if err != nil {
-      return nil, err
-    }
-    years = append(years, int(yr))
+  years := make([]int, 0, len(archives))
+  for year, _ := range archives {
+    years = append(years, year)
   }
 
   sort.Ints(years)
 
   return &Store{
-    Store: s,
-    Years: years,
+    Store:    s,
+    Years:    years,
+    archives: archives,
   }, nil
 }
@@ -0,0 +1,130 @@
+package gsod
+
+import (
+  "coriolis"
+  "testing"
+)
+
+const testLine = "725030 14732  20130101    34.8 24    21.0 24  1016.5 24  1015.8 24   10.0 24   11.6 24   19.0   28.0    41.0*   28.9   0.00G 999.9  000000"
+
+func TestToSummary(t *testing.T) {
+  var s coriolis.Summary
+  if err := toSummary(&s, &coriolis.Station{}, testLine); err != nil {
+    t.Fatal(err)
+  }
+
+  if s.Day.Year() != 2013 || s.Day.Month() != 1 || s.Day.Day() != 1 {
+    t.Errorf("expected 2013-01-01, got %s", s.Day)
+  }
+
+  if !s.Has(coriolis.FieldTempAvg|coriolis.FieldTempMax|coriolis.FieldTempMin|coriolis.FieldPrecip) {
+    t.Errorf("expected temps & precip to be valid, got %b", s.Valid)
+  }
+
+  if s.TempAvg != 34.8 || s.TempMax != 41.0 || s.TempMin != 28.9 {
+    t.Errorf("unexpected temps: %v %v %v", s.TempAvg, s.TempMax, s.TempMin)
+  }
+
+  if s.Has(coriolis.FieldSnowDepth) || s.SnowDepth != 0 {
+    t.Errorf("expected snow depth to be missing, got %v", s.SnowDepth)
+  }
+
+  if s.DewPoint != 21.0 || s.SeaLevelPressure != 1016.5 || s.StationPressure != 1015.8 {
+    t.Errorf("unexpected dew point & pressure: %v %v %v", s.DewPoint, s.SeaLevelPressure, s.StationPressure)
+  }
+
+  if s.Visibility != 10.0 || s.Gust != 28.0 {
+    t.Errorf("unexpected visibility & gust: %v %v", s.Visibility, s.Gust)
+  }
+
+  if s.TempAvgCount != 24 || s.WindAvgCount != 24 {
+    t.Errorf("unexpected counts: %d %d", s.TempAvgCount, s.WindAvgCount)
+  }
+
+  if s.Events != 0 {
+    t.Errorf("expected no events, got %b", s.Events)
+  }
+}
+
+func TestEvents(t *testing.T) {
+  l := testLine[:132] + "010010"
+
+  var s coriolis.Summary
+  if err := toSummary(&s, &coriolis.Station{}, l); err != nil {
+    t.Fatal(err)
+  }
+
+  if !s.Had(coriolis.EventRain|coriolis.EventThunder) || s.Had(coriolis.EventFog) || s.Had(coriolis.EventSnow) {
+    t.Errorf("unexpected events: %b", s.Events)
+  }
+}
+
+func TestMissingTempMin(t *testing.T) {
+  l := testLine[:110] + "9999.9" + testLine[116:]
+
+  var s coriolis.Summary
+  if err := toSummary(&s, &coriolis.Station{}, l); err != nil {
+    t.Fatal(err)
+  }
+
+  if s.Has(coriolis.FieldTempMin) {
+    t.Errorf("expected TempMin to be missing")
+  }
+
+  if !s.Has(coriolis.FieldTempMax) {
+    t.Errorf("expected TempMax to be valid")
+  }
+}
+
+func TestFlags(t *testing.T) {
+  var s coriolis.Summary
+  if err := toSummary(&s, &coriolis.Station{}, testLine); err != nil {
+    t.Fatal(err)
+  }
+
+  if !s.TempMaxDerived || s.TempMinDerived {
+    t.Errorf("unexpected derived flags: %v %v", s.TempMaxDerived, s.TempMinDerived)
+  }
+
+  if s.PrecipFlag != 'G' || !s.PrecipComplete() {
+    t.Errorf("expected complete precip, got %c", s.PrecipFlag)
+  }
+
+  l := testLine[:123] + "A" + testLine[124:]
+  if err := toSummary(&s, &coriolis.Station{}, l); err != nil {
+    t.Fatal(err)
+  }
+
+  if s.PrecipHours() != 6 || s.PrecipComplete() {
+    t.Errorf("expected 6 hours of precip, got %d", s.PrecipHours())
+  }
+
+  l = testLine[:123] + "I" + testLine[124:]
+  if err := toSummary(&s, &coriolis.Station{}, l); err != nil {
+    t.Fatal(err)
+  }
+
+  if s.Has(coriolis.FieldPrecip) {
+    t.Errorf("expected precip to be missing with flag I")
+  }
+}
+
+func TestParseError(t *testing.T) {
+  l := testLine[:24] + "  3X.8" + testLine[30:]
+
+  var s coriolis.Summary
+  err := toSummary(&s, &coriolis.Station{}, l)
+  pe, ok := err.(*ParseError)
+  if !ok {
+    t.Fatalf("expected a ParseError, got %v", err)
+  }
+
+  if pe.Begin != 24 || pe.End != 30 {
+    t.Errorf("expected columns 24-30, got %d-%d", pe.Begin, pe.End)
+  }
+
+  err = toSummary(&s, &coriolis.Station{}, testLine[:100])
+  if pe, ok := err.(*ParseError); !ok || pe.Begin != 100 {
+    t.Errorf("expected a short line error, got %v", err)
+  }
+}
@@ -0,0 +1,249 @@
+package gsod
+
+import (
+  "archive/tar"
+  "coriolis"
+  "encoding/json"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+)
+
+// The location of a single station's member within a gsod_YYYY.tar archive.
+type IndexEntry struct {
+  Name   string
+  Offset int64
+  Size   int64
+}
+
+// Maps a station id to the location of its data within a year's archive.
+type Index map[string]*IndexEntry
+
+// The path of the persisted index for an archive.
+func indexFilename(archive string) string {
+  return archive + ".idx"
+}
+
+// Extract the station id from the name of an archive member, which looks
+// like ./010010-99999-1990.op.gz or, for CSV, 01001099999.csv
+func stationIdFromMember(name string) (string, bool) {
+  base := filepath.Base(name)
+  if len(base) >= 12 && base[6] == '-' && strings.HasSuffix(base, ".op.gz") {
+    return base[:12], true
+  }
+
+  if strings.HasSuffix(base, ".csv") || strings.HasSuffix(base, ".csv.gz") {
+    if id, err := csvStationId(base[:strings.Index(base, ".")]); err == nil {
+      return id, true
+    }
+  }
+
+  return "", false
+}
+
+// Scan an archive and record the offset of every station's member.
+func BuildIndex(archive string) (Index, error) {
+  r, err := os.Open(archive)
+  if err != nil {
+    return nil, err
+  }
+  defer r.Close()
+
+  idx := Index{}
+  tr := tar.NewReader(r)
+  for {
+    h, err := tr.Next()
+    if err == io.EOF {
+      return idx, nil
+    } else if err != nil {
+      return nil, err
+    }
+
+    id, ok := stationIdFromMember(h.Name)
+    if !ok || h.FileInfo().IsDir() {
+      continue
+    }
+
+    // the tar reader leaves the file positioned at the start of the member.
+    off, err := r.Seek(0, io.SeekCurrent)
+    if err != nil {
+      return nil, err
+    }
+
+    idx[id] = &IndexEntry{
+      Name:   h.Name,
+      Offset: off,
+      Size:   h.Size,
+    }
+  }
+}
+
+// Write the index to a file. The index is written to a temporary file first,
+// so concurrent saves of the same index never interleave.
+func (x Index) Save(filename string) error {
+  w, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+  if err != nil {
+    return err
+  }
+
+  if err := json.NewEncoder(w).Encode(x); err != nil {
+    w.Close()
+    os.Remove(w.Name())
+    return err
+  }
+
+  if err := w.Close(); err != nil {
+    os.Remove(w.Name())
+    return err
+  }
+
+  return os.Rename(w.Name(), filename)
+}
+
+// Load a previously saved index.
+func LoadIndex(filename string) (Index, error) {
+  r, err := os.Open(filename)
+  if err != nil {
+    return nil, err
+  }
+  defer r.Close()
+
+  var x Index
+  if err := json.NewDecoder(r).Decode(&x); err != nil {
+    return nil, err
+  }
+
+  return x, nil
+}
+
+// Load the index for an archive, building and persisting it if it is missing
+// or older than the archive.
+func openIndex(archive string) (Index, error) {
+  fi, err := os.Stat(archive)
+  if err != nil {
+    return nil, err
+  }
+
+  filename := indexFilename(archive)
+  if xi, err := os.Stat(filename); err == nil && !xi.ModTime().Before(fi.ModTime()) {
+    if x, err := LoadIndex(filename); err == nil {
+      return x, nil
+    }
+  }
+
+  x, err := BuildIndex(archive)
+  if err != nil {
+    return nil, err
+  }
+
+  if err := x.Save(filename); err != nil {
+    return nil, err
+  }
+
+  return x, nil
+}
+
+// Get the index for the given year, loading it the first time it is needed.
+// The index is built without holding the store's lock, since that can mean
+// scanning an entire archive.
+func (s *Store) IndexFor(year int) (Index, error) {
+  s.lck.Lock()
+  x, ok := s.indexes[year]
+  s.lck.Unlock()
+  if ok {
+    return x, nil
+  }
+
+  archive := s.archiveFor(year)
+  if !isSeekable(archive) {
+    return nil, fmt.Errorf("%s: only uncompressed tars can be indexed", archive)
+  }
+
+  x, err := openIndex(archive)
+  if err != nil {
+    return nil, err
+  }
+
+  s.lck.Lock()
+  defer s.lck.Unlock()
+
+  // another reader may have loaded the same index in the meantime.
+  if o, ok := s.indexes[year]; ok {
+    return o, nil
+  }
+
+  if s.indexes == nil {
+    s.indexes = map[int]Index{}
+  }
+  s.indexes[year] = x
+  return x, nil
+}
+
+// Iterate over the summaries for a single station in each of the given years.
+// Rather than streaming the entire archive, this seeks directly to the
+// station's member using the index. Archives that cannot be indexed are
+// scanned for the station's member instead. Years in which the station has
+// no data are skipped.
+func (s *Store) ForEachSummaryForStation(id string, years []int, fn func(s *coriolis.Summary) error) error {
+  station := s.StationIndex[id]
+  if station == nil {
+    return fmt.Errorf("unknown station: %s", id)
+  }
+
+  stations := map[string]*coriolis.Station{
+    id: station,
+  }
+
+  var summary coriolis.Summary
+  for _, year := range years {
+    if archive := s.archiveFor(year); !isSeekable(archive) {
+      if err := forEachMember(archive,
+        func(name string) bool {
+          sid, ok := stationIdFromMember(name)
+          return ok && sid == id
+        },
+        func(r io.Reader, name string) error {
+          return forEachSummaryInMember(r, archive, name, stations, &summary, fn, s.badRecord)
+        }); err != nil {
+        return err
+      }
+      continue
+    }
+
+    x, err := s.IndexFor(year)
+    if err != nil {
+      return err
+    }
+
+    e := x[id]
+    if e == nil {
+      continue
+    }
+
+    if err := s.forEachSummaryAt(year, e, stations, &summary, fn); err != nil {
+      return err
+    }
+  }
+
+  return nil
+}
+
+func (s *Store) forEachSummaryAt(
+  year int,
+  e *IndexEntry,
+  stations map[string]*coriolis.Station,
+  summary *coriolis.Summary,
+  fn func(s *coriolis.Summary) error) error {
+  archive := s.archiveFor(year)
+  r, err := os.Open(archive)
+  if err != nil {
+    return err
+  }
+  defer r.Close()
+
+  return forEachSummaryInMember(
+    io.NewSectionReader(r, e.Offset, e.Size), archive, e.Name, stations, summary, fn, s.badRecord)
+}
@@ -0,0 +1,92 @@
+package gsod
+
+import (
+  "archive/tar"
+  "bytes"
+  "compress/gzip"
+  "coriolis"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "testing"
+)
+
+// Write a gsod_YYYY.tar archive with one member per station.
+func writeArchive(t *testing.T, filename string, members map[string][]string) {
+  w, err := os.Create(filename)
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer w.Close()
+
+  tw := tar.NewWriter(w)
+  for name, lines := range members {
+    var buf bytes.Buffer
+    gw := gzip.NewWriter(&buf)
+    gw.Write([]byte("STN--- WBAN   YEARMODA    TEMP\n"))
+    for _, line := range lines {
+      gw.Write([]byte(line + "\n"))
+    }
+    gw.Close()
+
+    if err := tw.WriteHeader(&tar.Header{
+      Name: name,
+      Mode: 0644,
+      Size: int64(buf.Len()),
+    }); err != nil {
+      t.Fatal(err)
+    }
+
+    if _, err := tw.Write(buf.Bytes()); err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  if err := tw.Close(); err != nil {
+    t.Fatal(err)
+  }
+}
+
+func TestForEachSummaryForStation(t *testing.T) {
+  dir, err := ioutil.TempDir("", "gsod")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+
+  other := "722950 23174" + testLine[12:]
+  writeArchive(t, filepath.Join(dir, "gsod_2013.tar"), map[string][]string{
+    "./725030-14732-2013.op.gz": []string{testLine, testLine[:20] + "02" + testLine[22:]},
+    "./722950-23174-2013.op.gz": []string{other},
+  })
+
+  a := &coriolis.Station{Usaf: "725030", Wban: "14732"}
+  b := &coriolis.Station{Usaf: "722950", Wban: "23174"}
+  s, err := NewStore(&coriolis.Store{
+    Dir:          dir,
+    Stations:     []*coriolis.Station{a, b},
+    StationIndex: map[string]*coriolis.Station{a.Id(): a, b.Id(): b},
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  var days []int
+  if err := s.ForEachSummaryForStation(a.Id(), []int{2013}, func(s *coriolis.Summary) error {
+    if s.Station != a {
+      t.Errorf("expected station %s, got %s", a.Id(), s.Station.Id())
+    }
+    days = append(days, s.Day.Day())
+    return nil
+  }); err != nil {
+    t.Fatal(err)
+  }
+
+  if len(days) != 2 || days[0] != 1 || days[1] != 2 {
+    t.Errorf("expected days [1 2], got %v", days)
+  }
+
+  if _, err := os.Stat(filepath.Join(dir, "gsod_2013.tar.idx")); err != nil {
+    t.Errorf("expected index to be persisted: %s", err)
+  }
+}
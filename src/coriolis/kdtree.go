@@ -0,0 +1,154 @@
+package coriolis
+
+import (
+  "math"
+
+  "projection"
+  "util"
+)
+
+// A station placed on the unit sphere. The straight-line (chord) distance
+// between two such points grows with the great-circle distance, so the
+// tree can split on plain cartesian axes and still find the nearest
+// stations on the earth's surface.
+type kdPoint struct {
+  s *Station
+  p [3]float64
+}
+
+// A static k-d tree laid out implicitly in a slice: the median of each
+// range is its root and the halves on either side are its children.
+type kdTree struct {
+  pts []kdPoint
+}
+
+func toUnit(lat, lon float64) [3]float64 {
+  p, l := toRadians(lat), toRadians(lon)
+  return [3]float64{
+    math.Cos(p) * math.Cos(l),
+    math.Cos(p) * math.Sin(l),
+    math.Sin(p),
+  }
+}
+
+func chord(a, b *[3]float64) float64 {
+  dx, dy, dz := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+  return dx*dx + dy*dy + dz*dz
+}
+
+func newKdTree(stations []*Station) *kdTree {
+  pts := make([]kdPoint, len(stations))
+  for i, s := range stations {
+    pts[i] = kdPoint{
+      s: s,
+      p: toUnit(s.Lat, s.Lon),
+    }
+  }
+
+  t := &kdTree{pts: pts}
+  t.build(0, len(pts), 0)
+  return t
+}
+
+func (t *kdTree) build(lo, hi, axis int) {
+  if hi-lo <= 1 {
+    return
+  }
+
+  pts := t.pts[lo:hi]
+  util.Sort(len(pts),
+    func(i, j int) bool {
+      return pts[i].p[axis] < pts[j].p[axis]
+    },
+    func(i, j int) {
+      pts[i], pts[j] = pts[j], pts[i]
+    })
+
+  mid := (lo + hi) / 2
+  t.build(lo, mid, (axis+1)%3)
+  t.build(mid+1, hi, (axis+1)%3)
+}
+
+// The k nearest points found so far, ordered by (squared chord) distance.
+type kdResult struct {
+  k    int
+  max  float64
+  pts  []*kdPoint
+  dist []float64
+}
+
+func (r *kdResult) bound() float64 {
+  if len(r.pts) < r.k {
+    return r.max
+  }
+  return r.dist[len(r.dist)-1]
+}
+
+func (r *kdResult) add(p *kdPoint, d float64) {
+  if d > r.bound() {
+    return
+  }
+
+  i := len(r.pts)
+  if i < r.k {
+    r.pts = append(r.pts, nil)
+    r.dist = append(r.dist, 0)
+  } else {
+    i--
+  }
+
+  for ; i > 0 && r.dist[i-1] > d; i-- {
+    r.pts[i], r.dist[i] = r.pts[i-1], r.dist[i-1]
+  }
+  r.pts[i], r.dist[i] = p, d
+}
+
+func (t *kdTree) search(lo, hi, axis int, q *[3]float64, r *kdResult, fn func(s *Station) bool) {
+  if hi <= lo {
+    return
+  }
+
+  mid := (lo + hi) / 2
+  p := &t.pts[mid]
+  if fn == nil || fn(p.s) {
+    r.add(p, chord(&p.p, q))
+  }
+
+  next := (axis + 1) % 3
+  d := q[axis] - p.p[axis]
+  if d < 0 {
+    t.search(lo, mid, next, q, r, fn)
+    if d*d <= r.bound() {
+      t.search(mid+1, hi, next, q, r, fn)
+    }
+  } else {
+    t.search(mid+1, hi, next, q, r, fn)
+    if d*d <= r.bound() {
+      t.search(lo, mid, next, q, r, fn)
+    }
+  }
+}
+
+// Find up to k stations nearest to (lat, lon) that are within maxDist meters and
+// for which fn, if it is not nil, returns true. A maxDist of 0 means no limit.
+func (t *kdTree) nearest(lat, lon float64, k int, maxDist float64, fn func(s *Station) bool) []*Station {
+  r := kdResult{
+    k:   k,
+    max: math.Inf(1),
+  }
+
+  // convert the great-circle limit into a squared chord length.
+  if maxDist > 0 && maxDist < math.Pi*projection.EarthRadius {
+    c := 2 * math.Sin(maxDist/(2*projection.EarthRadius))
+    r.max = c * c
+  }
+
+  q := toUnit(lat, lon)
+  t.search(0, len(t.pts), 0, &q, &r, fn)
+
+  stations := make([]*Station, len(r.pts))
+  for i, p := range r.pts {
+    stations[i] = p.s
+  }
+  return stations
+}
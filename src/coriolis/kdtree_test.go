@@ -0,0 +1,62 @@
+package coriolis
+
+import (
+  "math/rand"
+  "testing"
+
+  "util"
+)
+
+// Find the k nearest by checking every station.
+func bruteNearest(stations []*Station, lat, lon float64, k int, maxDist float64) []*Station {
+  var res []*Station
+  for _, s := range stations {
+    if maxDist == 0 || Distance(lat, lon, s.Lat, s.Lon) <= maxDist {
+      res = append(res, s)
+    }
+  }
+
+  util.Sort(len(res),
+    func(i, j int) bool {
+      return Distance(lat, lon, res[i].Lat, res[i].Lon) < Distance(lat, lon, res[j].Lat, res[j].Lon)
+    },
+    func(i, j int) {
+      res[i], res[j] = res[j], res[i]
+    })
+
+  if len(res) > k {
+    res = res[:k]
+  }
+  return res
+}
+
+func TestNearest(t *testing.T) {
+  rng := rand.New(rand.NewSource(1))
+  s := &Store{}
+  for i := 0; i < 500; i++ {
+    s.Stations = append(s.Stations, &Station{
+      Lat: 20 + rng.Float64()*50,
+      Lon: -130 + rng.Float64()*70,
+    })
+  }
+
+  for i := 0; i < 50; i++ {
+    lat, lon := 25+rng.Float64()*40, -125+rng.Float64()*60
+    for _, maxDist := range []float64{0, 300e3} {
+      got := s.Nearest(lat, lon, 20, maxDist)
+      exp := bruteNearest(s.Stations, lat, lon, 20, maxDist)
+      if len(got) != len(exp) {
+        t.Fatalf("(%v, %v): expected %d stations, got %d", lat, lon, len(exp), len(got))
+      }
+      for j := range exp {
+        if got[j] != exp[j] {
+          t.Fatalf("(%v, %v): station %d differs", lat, lon, j)
+        }
+      }
+    }
+  }
+
+  if n := len(s.Nearest(40, -100, 0, 0)); n != 0 {
+    t.Errorf("expected no stations, got %d", n)
+  }
+}
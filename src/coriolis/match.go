@@ -0,0 +1,284 @@
+package coriolis
+
+import (
+  "math"
+  "strings"
+)
+
+// The stations of a single dataset, such as gsod or ghcnd.
+type Dataset struct {
+  Name     string
+  Stations []*Station
+}
+
+// How a record was linked to a canonical station.
+type MatchKind string
+
+const (
+  MatchNone      MatchKind = ""
+  MatchWban      MatchKind = "wban"
+  MatchIcao      MatchKind = "icao"
+  MatchProximity MatchKind = "proximity"
+)
+
+// A station as it appears in one dataset.
+type Record struct {
+  Dataset string
+  Station *Station
+  By      MatchKind
+
+  // The distance in meters to the canonical station's first record.
+  Dist float64
+}
+
+// A single physical station along with its records in each of the datasets.
+// The first record is the one from the earliest dataset.
+type Canonical struct {
+  Id      string
+  Records []*Record
+}
+
+// The record of the canonical station from the earliest dataset.
+func (c *Canonical) Station() *Station {
+  return c.Records[0].Station
+}
+
+// Whether the canonical station already has a record from the dataset.
+func (c *Canonical) In(dataset string) bool {
+  for _, r := range c.Records {
+    if r.Dataset == dataset {
+      return true
+    }
+  }
+  return false
+}
+
+// A record that could have been linked to more than one canonical station. It
+// is linked to the nearest of the candidates.
+type Ambiguity struct {
+  Record     *Record
+  Candidates []*Canonical
+}
+
+// The canonical stations across several datasets.
+type Matching struct {
+  Stations  []*Canonical
+  Ambiguous []*Ambiguity
+}
+
+// Controls how records are matched.
+type MatchOptions struct {
+  // Records sharing a WBAN or ICAO identifier are only linked within
+  // IdMaxDist meters, which guards against reused identifiers.
+  IdMaxDist float64
+
+  // Records without a shared identifier are linked if they are within
+  // MaxDist meters, their elevations (if both are known) are within
+  // MaxElevDiff meters and their names are at least MinNameSimilarity
+  // alike (0-1).
+  MaxDist           float64
+  MaxElevDiff       float64
+  MinNameSimilarity float64
+}
+
+var DefaultMatchOptions = MatchOptions{
+  IdMaxDist:         20000,
+  MaxDist:           1000,
+  MaxElevDiff:       30,
+  MinNameSimilarity: 0.3,
+}
+
+// Common abbreviations in station names.
+var nameAbbrevs = map[string]string{
+  "AP":    "AIRPORT",
+  "ARPT":  "AIRPORT",
+  "AIRPT": "AIRPORT",
+  "INT":   "INTERNATIONAL",
+  "INTL":  "INTERNATIONAL",
+  "INTNL": "INTERNATIONAL",
+  "RGNL":  "REGIONAL",
+  "REGL":  "REGIONAL",
+  "MUNI":  "MUNICIPAL",
+  "CNTY":  "COUNTY",
+  "FLD":   "FIELD",
+  "MT":    "MOUNT",
+  "FT":    "FORT",
+  "ST":    "SAINT",
+}
+
+// Split a station name into normalized words.
+func nameWords(name string) map[string]bool {
+  words := map[string]bool{}
+  for _, w := range strings.FieldsFunc(strings.ToUpper(name), func(r rune) bool {
+    return !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+  }) {
+    if a, ok := nameAbbrevs[w]; ok {
+      w = a
+    }
+    words[w] = true
+  }
+  return words
+}
+
+// The similarity (0-1) of two station names, which is the fraction of their
+// words, after expanding abbreviations, that they share.
+func NameSimilarity(a, b string) float64 {
+  wa, wb := nameWords(a), nameWords(b)
+  if len(wa) == 0 || len(wb) == 0 {
+    return 0
+  }
+
+  n := 0
+  for w, _ := range wa {
+    if wb[w] {
+      n++
+    }
+  }
+  return float64(n) / float64(len(wa)+len(wb)-n)
+}
+
+// Whether the WBAN is a real identifier rather than a placeholder.
+func hasWban(s *Station) bool {
+  return s.Wban != "" && s.Wban != "99999"
+}
+
+// Whether two stations are alike enough to be linked by proximity.
+func (o *MatchOptions) alike(a, b *Station) bool {
+  if a.HasElev && b.HasElev && math.Abs(a.Elev-b.Elev) > o.MaxElevDiff {
+    return false
+  }
+  return NameSimilarity(a.Name, b.Name) >= o.MinNameSimilarity
+}
+
+// The canonical stations indexed for matching against a later dataset.
+type matchIndex struct {
+  wban  map[string][]*Canonical
+  icao  map[string][]*Canonical
+  store *Store
+  by    map[*Station]*Canonical
+}
+
+func newMatchIndex(stations []*Canonical) *matchIndex {
+  x := &matchIndex{
+    wban: map[string][]*Canonical{},
+    icao: map[string][]*Canonical{},
+    by:   map[*Station]*Canonical{},
+  }
+
+  var all []*Station
+  for _, c := range stations {
+    for _, r := range c.Records {
+      if hasWban(r.Station) {
+        x.wban[r.Station.Wban] = appendCanonical(x.wban[r.Station.Wban], c)
+      }
+      if r.Station.Call != "" {
+        x.icao[r.Station.Call] = appendCanonical(x.icao[r.Station.Call], c)
+      }
+    }
+
+    s := c.Station()
+    x.by[s] = c
+    all = append(all, s)
+  }
+
+  x.store = NewStore("", all)
+  return x
+}
+
+// Append c to cs unless it is already there.
+func appendCanonical(cs []*Canonical, c *Canonical) []*Canonical {
+  for _, o := range cs {
+    if o == c {
+      return cs
+    }
+  }
+  return append(cs, c)
+}
+
+// Find the canonical stations that the record of s in dataset might be.
+func (x *matchIndex) candidates(s *Station, dataset string, o *MatchOptions) ([]*Canonical, MatchKind) {
+  within := func(cs []*Canonical) []*Canonical {
+    var res []*Canonical
+    for _, c := range cs {
+      if !c.In(dataset) && s.DistanceTo(c.Station()) <= o.IdMaxDist {
+        res = append(res, c)
+      }
+    }
+    return res
+  }
+
+  if hasWban(s) {
+    if cs := within(x.wban[s.Wban]); len(cs) > 0 {
+      return cs, MatchWban
+    }
+  }
+
+  if s.Call != "" {
+    if cs := within(x.icao[s.Call]); len(cs) > 0 {
+      return cs, MatchIcao
+    }
+  }
+
+  var res []*Canonical
+  for _, n := range x.store.Nearest(s.Lat, s.Lon, 16, o.MaxDist) {
+    c := x.by[n]
+    if !c.In(dataset) && o.alike(s, n) {
+      res = append(res, c)
+    }
+  }
+
+  if len(res) == 0 {
+    return nil, MatchNone
+  }
+  return res, MatchProximity
+}
+
+// Link the stations of several datasets into a single list of canonical
+// stations. The datasets are taken in order and each station is linked to a
+// canonical station from an earlier dataset by a shared WBAN or ICAO
+// identifier or, lacking one, by proximity along with a similar elevation and
+// name. ICAO codes only link datasets whose stations carry them (GHCN-Daily's
+// do not). Stations that cannot be linked become new canonical stations.
+// Stations within a single dataset are never linked to each other.
+func Match(datasets []*Dataset, o *MatchOptions) *Matching {
+  m := &Matching{}
+  for _, d := range datasets {
+    x := newMatchIndex(m.Stations)
+    for _, s := range d.Stations {
+      r := &Record{
+        Dataset: d.Name,
+        Station: s,
+      }
+
+      cs, by := x.candidates(s, d.Name, o)
+      if len(cs) == 0 {
+        m.Stations = append(m.Stations, &Canonical{
+          Id:      d.Name + ":" + s.Id(),
+          Records: []*Record{r},
+        })
+        continue
+      }
+
+      // link to the nearest candidate.
+      best := cs[0]
+      for _, c := range cs[1:] {
+        if s.DistanceTo(c.Station()) < s.DistanceTo(best.Station()) {
+          best = c
+        }
+      }
+
+      r.By = by
+      r.Dist = s.DistanceTo(best.Station())
+      best.Records = append(best.Records, r)
+
+      if len(cs) > 1 {
+        m.Ambiguous = append(m.Ambiguous, &Ambiguity{
+          Record:     r,
+          Candidates: cs,
+        })
+      }
+    }
+  }
+
+  return m
+}
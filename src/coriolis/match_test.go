@@ -0,0 +1,113 @@
+package coriolis
+
+import (
+  "testing"
+)
+
+func TestNameSimilarity(t *testing.T) {
+  if s := NameSimilarity("NEW YORK/LA GUARDIA ARPT", "NEW YORK LA GUARDIA AP"); s != 1 {
+    t.Errorf("expected identical names, got %v", s)
+  }
+
+  if s := NameSimilarity("DENVER INTL AP", "BOULDER"); s != 0 {
+    t.Errorf("expected unrelated names, got %v", s)
+  }
+
+  if s := NameSimilarity("", "BOULDER"); s != 0 {
+    t.Errorf("expected 0 for an empty name, got %v", s)
+  }
+}
+
+func TestMatch(t *testing.T) {
+  jfk := &Station{Usaf: "744860", Wban: "94789", Name: "JOHN F KENNEDY INTL AP",
+    Lat: 40.639, Lon: -73.762, Elev: 3.4, HasElev: true}
+  den := &Station{Usaf: "725650", Wban: "03017", Name: "DENVER INTL AP",
+    Lat: 39.833, Lon: -104.658, Elev: 1650, HasElev: true}
+  bou := &Station{Usaf: "720533", Wban: "99999", Name: "BOULDER MUNI",
+    Lat: 40.039, Lon: -105.226, Elev: 1612, HasElev: true}
+  bou2 := &Station{Usaf: "720534", Wban: "99999", Name: "BOULDER",
+    Lat: 40.041, Lon: -105.228, Elev: 1615, HasElev: true}
+
+  datasets := []*Dataset{
+    &Dataset{"gsod", []*Station{jfk, den, bou, bou2}},
+    &Dataset{"ghcnd", []*Station{
+      // linked to jfk by wban, though the coordinates differ a little.
+      &Station{Ghcn: "USW00094789", Wban: "94789", Name: "NEW YORK JFK INTL AP",
+        Lat: 40.6386, Lon: -73.7622, Elev: 3.4, HasElev: true},
+      // linked to den by proximity and name.
+      &Station{Ghcn: "USC00000001", Name: "DENVER INTERNATIONAL AIRPORT",
+        Lat: 39.835, Lon: -104.659, Elev: 1652, HasElev: true},
+      // near den but not alike.
+      &Station{Ghcn: "USC00000002", Name: "WATKINS",
+        Lat: 39.834, Lon: -104.656, Elev: 1651, HasElev: true},
+      // near den and alike, but much higher.
+      &Station{Ghcn: "USC00000003", Name: "DENVER INTL TOWER",
+        Lat: 39.833, Lon: -104.658, Elev: 1750, HasElev: true},
+      // between the two boulder stations.
+      &Station{Ghcn: "USC00000004", Name: "BOULDER",
+        Lat: 40.0395, Lon: -105.2265, Elev: 1613, HasElev: true},
+    }},
+  }
+
+  m := Match(datasets, &DefaultMatchOptions)
+
+  byId := map[string]*Canonical{}
+  for _, c := range m.Stations {
+    byId[c.Id] = c
+  }
+
+  if len(m.Stations) != 6 {
+    t.Fatalf("expected 6 stations, got %d", len(m.Stations))
+  }
+
+  c := byId["gsod:744860-94789"]
+  if len(c.Records) != 2 || c.Records[1].By != MatchWban || c.Records[1].Station.Id() != "USW00094789" {
+    t.Errorf("expected jfk to be linked by wban, got %+v", c.Records)
+  }
+
+  c = byId["gsod:725650-03017"]
+  if len(c.Records) != 2 || c.Records[1].By != MatchProximity || c.Records[1].Station.Id() != "USC00000001" {
+    t.Errorf("expected den to be linked by proximity, got %+v", c.Records)
+  }
+
+  for _, id := range []string{"ghcnd:USC00000002", "ghcnd:USC00000003"} {
+    if c := byId[id]; c == nil || len(c.Records) != 1 {
+      t.Errorf("expected %s to stand alone", id)
+    }
+  }
+
+  if len(m.Ambiguous) != 1 {
+    t.Fatalf("expected 1 ambiguous match, got %d", len(m.Ambiguous))
+  }
+
+  a := m.Ambiguous[0]
+  if a.Record.Station.Id() != "USC00000004" || len(a.Candidates) != 2 {
+    t.Errorf("unexpected ambiguity: %+v", a)
+  }
+
+  if c := byId["gsod:720533-99999"]; len(c.Records) != 2 {
+    t.Errorf("expected the nearest boulder station to be linked")
+  }
+}
+
+func TestMatchIcao(t *testing.T) {
+  // the same airport, listed under different names and a few km apart, with
+  // only the ICAO code in common.
+  a := &Station{Usaf: "722950", Wban: "99999", Call: "KLAX", Name: "LOS ANGELES INTL",
+    Lat: 33.938, Lon: -118.389}
+  b := &Station{Usaf: "722951", Wban: "99999", Call: "KLAX", Name: "LAX",
+    Lat: 33.950, Lon: -118.410}
+
+  m := Match([]*Dataset{
+    &Dataset{"a", []*Station{a}},
+    &Dataset{"b", []*Station{b}},
+  }, &DefaultMatchOptions)
+
+  if len(m.Stations) != 1 {
+    t.Fatalf("expected 1 station, got %d", len(m.Stations))
+  }
+
+  if r := m.Stations[0].Records; len(r) != 2 || r[1].By != MatchIcao {
+    t.Errorf("expected a link by icao, got %+v", r)
+  }
+}
@@ -0,0 +1,16 @@
+package coriolis
+
+// A dataset of daily summaries from a set of stations over a range of years,
+// such as GSOD or GHCN-Daily.
+type Source interface {
+  // The stations that contribute summaries.
+  StationStore() *Store
+
+  // The years for which there are summaries, in order.
+  YearRange() []int
+
+  // Call fn with each of the summaries for the given year. The summary passed
+  // to fn is reused between calls. fn may be called from a single goroutine at
+  // a time, but different years may be read concurrently.
+  ForEachSummaryInYear(year int, fn func(s *Summary) error) error
+}
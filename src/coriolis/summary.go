@@ -0,0 +1,115 @@
+package coriolis
+
+import (
+  "time"
+)
+
+// A bit set identifying the fields of a Summary.
+type Field uint32
+
+const (
+  FieldWindAvg Field = 1 << iota
+  FieldWindMax
+  FieldTempAvg
+  FieldTempMax
+  FieldTempMin
+  FieldPrecip
+  FieldSnowDepth
+  FieldDewPoint
+  FieldSeaLevelPressure
+  FieldStationPressure
+  FieldVisibility
+  FieldGust
+)
+
+// A bit set of the weather events (the FRSHTT column in GSOD) that occurred
+// during the day.
+type Event uint8
+
+const (
+  EventFog Event = 1 << iota
+  EventRain
+  EventSnow
+  EventHail
+  EventThunder
+  EventTornado
+)
+
+// A summary of the weather observed at a station during a single day.
+type Summary struct {
+  Station          *Station
+  Day              time.Time
+  WindAvg          float64
+  WindMax          float64
+  TempAvg          float64
+  TempMax          float64
+  TempMin          float64
+  Precip           float64
+  SnowDepth        float64
+  DewPoint         float64
+  SeaLevelPressure float64
+  StationPressure  float64
+  Visibility       float64
+  Gust             float64
+
+  // The number of observations used in computing each of the mean values.
+  TempAvgCount          int
+  DewPointCount         int
+  SeaLevelPressureCount int
+  StationPressureCount  int
+  VisibilityCount       int
+  WindAvgCount          int
+
+  // The weather events reported for the day.
+  Events Event
+
+  // Whether the max/min temperature was derived from the hourly data rather
+  // than an explicitly reported max/min (the * flag).
+  TempMaxDerived bool
+  TempMinDerived bool
+
+  // The attribute flag (A-I) that describes how the precipitation total
+  // was obtained, see PrecipHours.
+  PrecipFlag byte
+
+  // The fields whose values were flagged by the source's quality control but
+  // were kept anyway. GSOD has no such flags.
+  Suspect Field
+
+  // The set of fields that were actually reported. NOAA uses sentinel
+  // values (9999.9, 999.9, 99.99) for missing data, those fields are left
+  // as zero and are absent from this set.
+  Valid Field
+}
+
+// Indicates whether all of the fields in f were reported.
+func (s *Summary) Has(f Field) bool {
+  return s.Valid&f == f
+}
+
+// Indicates whether all of the events in e occurred.
+func (s *Summary) Had(e Event) bool {
+  return s.Events&e == e
+}
+
+// The number of hours covered by the precipitation total according to
+// PrecipFlag. A value less than 24 indicates a partial total and 0 means
+// the coverage is unknown.
+func (s *Summary) PrecipHours() int {
+  switch s.PrecipFlag {
+  case 'A':
+    return 6
+  case 'B', 'E':
+    return 12
+  case 'C':
+    return 18
+  case 'D', 'F', 'G':
+    return 24
+  }
+  return 0
+}
+
+// Indicates whether the precipitation total covers the entire day.
+func (s *Summary) PrecipComplete() bool {
+  return s.PrecipHours() >= 24
+}
@@ -0,0 +1,145 @@
+// Package geo reads boundary polygons and determines which cells of a grid
+// they cover.
+package geo
+
+import (
+  "encoding/json"
+  "fmt"
+  "io"
+  "math"
+  "os"
+)
+
+// A point in degrees.
+type Point struct {
+  Lat float64
+  Lon float64
+}
+
+// A closed ring of points, the last point need not repeat the first.
+type Ring []Point
+
+// A polygon is an outer ring followed by any number of holes.
+type Polygon []Ring
+
+// Compute the bounding box of the polygons.
+func Bounds(polys []Polygon) (min, max Point) {
+  min = Point{math.Inf(1), math.Inf(1)}
+  max = Point{math.Inf(-1), math.Inf(-1)}
+  for _, poly := range polys {
+    for _, ring := range poly {
+      for _, p := range ring {
+        min.Lat, max.Lat = math.Min(min.Lat, p.Lat), math.Max(max.Lat, p.Lat)
+        min.Lon, max.Lon = math.Min(min.Lon, p.Lon), math.Max(max.Lon, p.Lon)
+      }
+    }
+  }
+  return min, max
+}
+
+// The parts of a GeoJSON object needed to find its polygons.
+type geoJson struct {
+  Type        string
+  Coordinates json.RawMessage
+  Geometry    *geoJson
+  Geometries  []*geoJson
+  Features    []*geoJson
+}
+
+func toRing(c [][]float64) (Ring, error) {
+  r := make(Ring, 0, len(c))
+  for _, p := range c {
+    if len(p) < 2 {
+      return nil, fmt.Errorf("invalid position: %v", p)
+    }
+    // GeoJSON positions are lon, lat
+    r = append(r, Point{Lat: p[1], Lon: p[0]})
+  }
+  return r, nil
+}
+
+func toPolygon(c [][][]float64) (Polygon, error) {
+  p := make(Polygon, 0, len(c))
+  for _, rc := range c {
+    r, err := toRing(rc)
+    if err != nil {
+      return nil, err
+    }
+    p = append(p, r)
+  }
+  return p, nil
+}
+
+// Collect the polygons in a GeoJSON object, other geometries are ignored.
+func (g *geoJson) polygons(polys []Polygon) ([]Polygon, error) {
+  if g == nil {
+    return polys, nil
+  }
+
+  switch g.Type {
+  case "FeatureCollection":
+    for _, f := range g.Features {
+      var err error
+      if polys, err = f.polygons(polys); err != nil {
+        return nil, err
+      }
+    }
+  case "Feature":
+    return g.Geometry.polygons(polys)
+  case "GeometryCollection":
+    for _, f := range g.Geometries {
+      var err error
+      if polys, err = f.polygons(polys); err != nil {
+        return nil, err
+      }
+    }
+  case "Polygon":
+    var c [][][]float64
+    if err := json.Unmarshal(g.Coordinates, &c); err != nil {
+      return nil, err
+    }
+    p, err := toPolygon(c)
+    if err != nil {
+      return nil, err
+    }
+    polys = append(polys, p)
+  case "MultiPolygon":
+    var c [][][][]float64
+    if err := json.Unmarshal(g.Coordinates, &c); err != nil {
+      return nil, err
+    }
+    for _, pc := range c {
+      p, err := toPolygon(pc)
+      if err != nil {
+        return nil, err
+      }
+      polys = append(polys, p)
+    }
+  }
+
+  return polys, nil
+}
+
+// Read all of the polygons from a GeoJSON document.
+func ReadGeoJson(r io.Reader) ([]Polygon, error) {
+  var g geoJson
+  if err := json.NewDecoder(r).Decode(&g); err != nil {
+    return nil, err
+  }
+  return g.polygons(nil)
+}
+
+// Load all of the polygons from a GeoJSON file.
+func LoadGeoJson(filename string) ([]Polygon, error) {
+  r, err := os.Open(filename)
+  if err != nil {
+    return nil, err
+  }
+  defer r.Close()
+
+  polys, err := ReadGeoJson(r)
+  if err != nil {
+    return nil, fmt.Errorf("%s: %s", filename, err)
+  }
+  return polys, nil
+}
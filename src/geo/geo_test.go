@@ -0,0 +1,91 @@
+package geo
+
+import (
+  "strings"
+  "testing"
+)
+
+const testGeoJson = `{
+  "type": "FeatureCollection",
+  "features": [
+    {
+      "type": "Feature",
+      "properties": {"name": "square"},
+      "geometry": {
+        "type": "Polygon",
+        "coordinates": [[[1, 1], [5, 1], [5, 5], [1, 5], [1, 1]], [[2, 2], [4, 2], [4, 4], [2, 4], [2, 2]]]
+      }
+    },
+    {
+      "type": "Feature",
+      "geometry": {
+        "type": "MultiPolygon",
+        "coordinates": [[[[7, 7], [8, 7], [8, 8], [7, 7]]]]
+      }
+    },
+    {
+      "type": "Feature",
+      "geometry": {"type": "Point", "coordinates": [0, 0]}
+    }
+  ]
+}`
+
+// Treat lon as x and lat as y.
+func identity(lat, lon float64) (float64, float64) {
+  return lon, lat
+}
+
+func TestReadGeoJson(t *testing.T) {
+  polys, err := ReadGeoJson(strings.NewReader(testGeoJson))
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if len(polys) != 2 || len(polys[0]) != 2 || len(polys[1]) != 1 {
+    t.Fatalf("unexpected polygons: %v", polys)
+  }
+
+  if p := polys[0][0][1]; p.Lat != 1 || p.Lon != 5 {
+    t.Errorf("expected lat 1, lon 5, got %v", p)
+  }
+
+  min, max := Bounds(polys)
+  if min.Lat != 1 || min.Lon != 1 || max.Lat != 8 || max.Lon != 8 {
+    t.Errorf("unexpected bounds: %v %v", min, max)
+  }
+}
+
+func TestActiveCells(t *testing.T) {
+  polys, err := ReadGeoJson(strings.NewReader(testGeoJson))
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  cells := map[[2]int]bool{}
+  for _, c := range ActiveCells(polys, identity, 1, 10, 10) {
+    cells[[2]int{c[0], c[1]}] = true
+  }
+
+  expect := func(i, j int, active bool) {
+    if cells[[2]int{i, j}] != active {
+      t.Errorf("expected (%d,%d) active = %v", i, j, active)
+    }
+  }
+
+  // the edges of the outer ring & the hole
+  expect(1, 1, true)
+  expect(4, 4, true)
+  expect(5, 3, true)
+  expect(2, 3, true)
+
+  // the interior of the hole is not covered
+  expect(3, 3, false)
+
+  // outside
+  expect(0, 0, false)
+  expect(6, 6, false)
+  expect(9, 9, false)
+
+  // the triangle
+  expect(7, 7, true)
+}
@@ -0,0 +1,56 @@
+package geo
+
+import (
+  "encoding/json"
+  "os"
+)
+
+// Declares a grid of certain width & height with a list of
+// active cells. This is used to selectively turn off parts
+// of the grid.
+type GridConfig struct {
+  W      int
+  H      int
+  Size   int
+  Active [][]int
+
+  // The projection the grid is drawn in. Active cells computed for one
+  // projection do not line up with the stations under another.
+  Projection string
+
+  // The stations (gsod or ghcnd) a canvas grid was fit to. The canvas only
+  // lines up with the same stations.
+  Source string
+
+  // A grid may instead be defined geographically, in which case W & H (and
+  // Active, unless given) are derived. The cells are CellKm kilometers or
+  // CellDeg degrees (of latitude) on a side in the Projection and cover
+  // Bounds, given as [min lat, min lon, max lat, max lon]. When Boundary
+  // names a GeoJSON or shapefile (relative to the data directory), only the
+  // cells that intersect its polygons are active and Bounds defaults to its
+  // extent.
+  CellKm   float64
+  CellDeg  float64
+  Bounds   []float64
+  Boundary string
+}
+
+// Whether the grid is defined geographically rather than by W, H & Active.
+func (c *GridConfig) IsGeographic() bool {
+  return c.CellKm > 0 || c.CellDeg > 0
+}
+
+// Load the grid config from a file.
+func LoadGridConfig(filename string, c *GridConfig) error {
+  r, err := os.Open(filename)
+  if err != nil {
+    return err
+  }
+  defer r.Close()
+
+  if err := json.NewDecoder(r).Decode(c); err != nil {
+    return err
+  }
+
+  return nil
+}
@@ -0,0 +1,143 @@
+package geo
+
+import (
+  "math"
+  "sort"
+)
+
+// A point on the plane.
+type XY struct {
+  X float64
+  Y float64
+}
+
+// Project each of the rings of a polygon onto the plane with tx, which maps
+// lat, lon to x, y.
+func (p Polygon) Project(tx func(float64, float64) (float64, float64)) [][]XY {
+  rings := make([][]XY, 0, len(p))
+  for _, ring := range p {
+    r := make([]XY, 0, len(ring))
+    for _, pt := range ring {
+      x, y := tx(pt.Lat, pt.Lon)
+      r = append(r, XY{x, y})
+    }
+    rings = append(rings, r)
+  }
+  return rings
+}
+
+// Determine if the segment a-b passes through the rectangle [x0,x1]x[y0,y1]
+// using Liang-Barsky clipping.
+func segmentInRect(a, b XY, x0, y0, x1, y1 float64) bool {
+  dx, dy := b.X-a.X, b.Y-a.Y
+  t0, t1 := 0.0, 1.0
+  clip := func(p, q float64) bool {
+    if p == 0 {
+      return q >= 0
+    }
+    r := q / p
+    if p < 0 {
+      if r > t1 {
+        return false
+      }
+      t0 = math.Max(t0, r)
+    } else {
+      if r < t0 {
+        return false
+      }
+      t1 = math.Min(t1, r)
+    }
+    return true
+  }
+
+  return clip(-dx, a.X-x0) && clip(dx, x1-a.X) &&
+    clip(-dy, a.Y-y0) && clip(dy, y1-a.Y)
+}
+
+func clamp(v, lo, hi int) int {
+  if v < lo {
+    return lo
+  }
+  if v > hi {
+    return hi
+  }
+  return v
+}
+
+// Mark the cells of a w x h grid of square cells of the given size (cell
+// (i,j) spans [i*size, (i+1)*size) x [j*size, (j+1)*size)) that intersect
+// the polygon described by rings. A cell intersects the polygon if any edge
+// passes through it or if its center is inside the polygon. cells is indexed
+// as [i][j].
+func Rasterize(rings [][]XY, size float64, w, h int, cells [][]bool) {
+  // cells crossed by an edge
+  for _, ring := range rings {
+    for k, n := 0, len(ring); k < n; k++ {
+      a, b := ring[k], ring[(k+1)%n]
+      i0 := clamp(int(math.Floor(math.Min(a.X, b.X)/size)), 0, w-1)
+      i1 := clamp(int(math.Floor(math.Max(a.X, b.X)/size)), 0, w-1)
+      j0 := clamp(int(math.Floor(math.Min(a.Y, b.Y)/size)), 0, h-1)
+      j1 := clamp(int(math.Floor(math.Max(a.Y, b.Y)/size)), 0, h-1)
+      for i := i0; i <= i1; i++ {
+        for j := j0; j <= j1; j++ {
+          if cells[i][j] {
+            continue
+          }
+          x, y := float64(i)*size, float64(j)*size
+          cells[i][j] = segmentInRect(a, b, x, y, x+size, y+size)
+        }
+      }
+    }
+  }
+
+  // cells whose center is inside, filled one row at a time with the
+  // even-odd rule.
+  var xs []float64
+  for j := 0; j < h; j++ {
+    cy := (float64(j) + 0.5) * size
+    xs = xs[:0]
+    for _, ring := range rings {
+      for k, n := 0, len(ring); k < n; k++ {
+        a, b := ring[k], ring[(k+1)%n]
+        if (a.Y <= cy) == (b.Y <= cy) {
+          continue
+        }
+        xs = append(xs, a.X+(cy-a.Y)*(b.X-a.X)/(b.Y-a.Y))
+      }
+    }
+    sort.Float64s(xs)
+
+    for k := 0; k+1 < len(xs); k += 2 {
+      // the cells with centers in [xs[k], xs[k+1]]
+      i0 := clamp(int(math.Ceil(xs[k]/size-0.5)), 0, w)
+      i1 := clamp(int(math.Floor(xs[k+1]/size-0.5)), -1, w-1)
+      for i := i0; i <= i1; i++ {
+        cells[i][j] = true
+      }
+    }
+  }
+}
+
+// Find the cells of a w x h grid that intersect any of the polygons. The
+// polygons are placed on the grid with tx. The result is a list of [i, j]
+// pairs in column order.
+func ActiveCells(polys []Polygon, tx func(float64, float64) (float64, float64), size float64, w, h int) [][]int {
+  cells := make([][]bool, w)
+  for i := range cells {
+    cells[i] = make([]bool, h)
+  }
+
+  for _, poly := range polys {
+    Rasterize(poly.Project(tx), size, w, h, cells)
+  }
+
+  var active [][]int
+  for i := 0; i < w; i++ {
+    for j := 0; j < h; j++ {
+      if cells[i][j] {
+        active = append(active, []int{i, j})
+      }
+    }
+  }
+  return active
+}
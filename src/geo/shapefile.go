@@ -0,0 +1,137 @@
+package geo
+
+import (
+  "bufio"
+  "encoding/binary"
+  "fmt"
+  "io"
+  "math"
+  "os"
+  "path/filepath"
+  "strings"
+)
+
+// Shape types in an ESRI shapefile that hold polygons. The Z and M variants
+// carry extra measures after the points, which are ignored.
+const (
+  shapeNull     = 0
+  shapePolygon  = 5
+  shapePolygonZ = 15
+  shapePolygonM = 25
+)
+
+// Read all of the polygons from an ESRI shapefile (.shp). Coordinates are
+// assumed to be geographic (x is lon, y is lat), projected shapefiles are not
+// supported. Each record becomes a single polygon holding all of its parts,
+// which works for islands and holes alike under the even-odd rule.
+func ReadShapefile(r io.Reader) ([]Polygon, error) {
+  br := bufio.NewReader(r)
+
+  var hdr [100]byte
+  if _, err := io.ReadFull(br, hdr[:]); err != nil {
+    return nil, err
+  }
+
+  if code := binary.BigEndian.Uint32(hdr[0:4]); code != 9994 {
+    return nil, fmt.Errorf("not a shapefile, file code is %d", code)
+  }
+
+  var polys []Polygon
+  for n := 1; ; n++ {
+    var rh [8]byte
+    if _, err := io.ReadFull(br, rh[:]); err == io.EOF {
+      return polys, nil
+    } else if err != nil {
+      return nil, err
+    }
+
+    // the content length is in 16-bit words
+    buf := make([]byte, 2*int(binary.BigEndian.Uint32(rh[4:8])))
+    if _, err := io.ReadFull(br, buf); err != nil {
+      return nil, err
+    }
+
+    p, err := toShapePolygon(buf)
+    if err != nil {
+      return nil, fmt.Errorf("record %d: %s", n, err)
+    }
+
+    if p != nil {
+      polys = append(polys, p)
+    }
+  }
+}
+
+// Decode the content of a single record, returning nil for a null shape.
+func toShapePolygon(b []byte) (Polygon, error) {
+  if len(b) < 4 {
+    return nil, fmt.Errorf("truncated record")
+  }
+
+  switch t := binary.LittleEndian.Uint32(b[0:4]); t {
+  case shapeNull:
+    return nil, nil
+  case shapePolygon, shapePolygonZ, shapePolygonM:
+  default:
+    return nil, fmt.Errorf("unsupported shape type %d", t)
+  }
+
+  // shape type, bounding box, number of parts & points
+  if len(b) < 44 {
+    return nil, fmt.Errorf("truncated record")
+  }
+
+  np := int(binary.LittleEndian.Uint32(b[36:40]))
+  nv := int(binary.LittleEndian.Uint32(b[40:44]))
+  if len(b) < 44+4*np+16*nv {
+    return nil, fmt.Errorf("truncated record")
+  }
+
+  parts := make([]int, np+1)
+  for i := 0; i < np; i++ {
+    parts[i] = int(binary.LittleEndian.Uint32(b[44+4*i:]))
+  }
+  parts[np] = nv
+
+  pts := b[44+4*np:]
+  p := make(Polygon, 0, np)
+  for i := 0; i < np; i++ {
+    if parts[i] > parts[i+1] || parts[i+1] > nv {
+      return nil, fmt.Errorf("invalid part index %d", parts[i])
+    }
+
+    ring := make(Ring, 0, parts[i+1]-parts[i])
+    for k := parts[i]; k < parts[i+1]; k++ {
+      ring = append(ring, Point{
+        Lon: math.Float64frombits(binary.LittleEndian.Uint64(pts[16*k:])),
+        Lat: math.Float64frombits(binary.LittleEndian.Uint64(pts[16*k+8:])),
+      })
+    }
+    p = append(p, ring)
+  }
+
+  return p, nil
+}
+
+// Load all of the polygons from a shapefile.
+func LoadShapefile(filename string) ([]Polygon, error) {
+  r, err := os.Open(filename)
+  if err != nil {
+    return nil, err
+  }
+  defer r.Close()
+
+  polys, err := ReadShapefile(r)
+  if err != nil {
+    return nil, fmt.Errorf("%s: %s", filename, err)
+  }
+  return polys, nil
+}
+
+// Load the polygons from either a shapefile (.shp) or a GeoJSON file.
+func LoadBoundary(filename string) ([]Polygon, error) {
+  if strings.ToLower(filepath.Ext(filename)) == ".shp" {
+    return LoadShapefile(filename)
+  }
+  return LoadGeoJson(filename)
+}
@@ -0,0 +1,86 @@
+package geo
+
+import (
+  "bytes"
+  "encoding/binary"
+  "math"
+  "testing"
+)
+
+// Encode the rings as a single polygon record of a shapefile.
+func shapeRecord(n int, rings ...Ring) []byte {
+  var c bytes.Buffer
+  le := func(v interface{}) {
+    binary.Write(&c, binary.LittleEndian, v)
+  }
+
+  var nv int
+  for _, r := range rings {
+    nv += len(r)
+  }
+
+  le(int32(shapePolygon))
+  le([4]float64{})
+  le(int32(len(rings)))
+  le(int32(nv))
+  for i, k := 0, 0; i < len(rings); i++ {
+    le(int32(k))
+    k += len(rings[i])
+  }
+  for _, r := range rings {
+    for _, p := range r {
+      le(p.Lon)
+      le(p.Lat)
+    }
+  }
+
+  var b bytes.Buffer
+  binary.Write(&b, binary.BigEndian, int32(n))
+  binary.Write(&b, binary.BigEndian, int32(c.Len()/2))
+  b.Write(c.Bytes())
+  return b.Bytes()
+}
+
+func TestReadShapefile(t *testing.T) {
+  square := Ring{{1, 1}, {1, 5}, {5, 5}, {5, 1}, {1, 1}}
+  hole := Ring{{2, 2}, {4, 2}, {4, 4}, {2, 4}, {2, 2}}
+  tri := Ring{{7, 7}, {7, 8}, {8, 8}, {7, 7}}
+
+  var b bytes.Buffer
+  hdr := make([]byte, 100)
+  binary.BigEndian.PutUint32(hdr[0:], 9994)
+  binary.LittleEndian.PutUint32(hdr[28:], 1000)
+  binary.LittleEndian.PutUint32(hdr[32:], shapePolygon)
+  b.Write(hdr)
+  b.Write(shapeRecord(1, square, hole))
+  b.Write(shapeRecord(2, tri))
+
+  polys, err := ReadShapefile(&b)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if len(polys) != 2 || len(polys[0]) != 2 || len(polys[1]) != 1 {
+    t.Fatalf("unexpected polygons: %v", polys)
+  }
+
+  if p := polys[0][1][1]; p.Lat != 4 || p.Lon != 2 {
+    t.Errorf("expected lat 4, lon 2, got %v", p)
+  }
+
+  cells := ActiveCells(polys, identity, 1, 10, 10)
+  if len(cells) == 0 {
+    t.Errorf("expected active cells")
+  }
+
+  min, max := Bounds(polys)
+  if min.Lat != 1 || max.Lon != 8 || math.IsInf(min.Lon, 0) {
+    t.Errorf("unexpected bounds: %v %v", min, max)
+  }
+}
+
+func TestNotAShapefile(t *testing.T) {
+  if _, err := ReadShapefile(bytes.NewReader(make([]byte, 100))); err == nil {
+    t.Errorf("expected an error")
+  }
+}
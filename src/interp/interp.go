@@ -0,0 +1,129 @@
+// Package interp computes the weights used to estimate a value at a target
+// location from values sampled at nearby locations.
+package interp
+
+import (
+  "fmt"
+  "math"
+)
+
+type Interpolator interface {
+  // Compute the weight of each of n samples. target gives the distance from
+  // the ith sample to the target and between gives the distance between the
+  // ith and jth samples. Samples that should not contribute have a weight of
+  // zero, and the weights need not sum to one.
+  Weights(n int, target func(i int) float64, between func(i, j int) float64) ([]float64, error)
+}
+
+// Inverse distance weighting, each sample is weighted by 1/d^Power. Samples
+// further than Radius (when it is positive) are ignored. A sample at the
+// target takes all of the weight.
+type IDW struct {
+  Power  float64
+  Radius float64
+}
+
+func (p *IDW) Weights(n int, target func(i int) float64, between func(i, j int) float64) ([]float64, error) {
+  w := make([]float64, n)
+  for i := 0; i < n; i++ {
+    d := target(i)
+    if p.Radius > 0 && d > p.Radius {
+      continue
+    }
+
+    if d == 0 {
+      for j := range w {
+        w[j] = 0
+      }
+      w[i] = 1
+      return w, nil
+    }
+
+    w[i] = 1 / math.Pow(d, p.Power)
+  }
+  return w, nil
+}
+
+// Ordinary kriging with an exponential variogram. The sill is normalized to
+// one, Nugget is the fraction of it that is uncorrelated noise and Range is
+// the (practical) distance at which samples become uncorrelated.
+type Kriging struct {
+  Range  float64
+  Nugget float64
+}
+
+// The covariance of distinct samples at distance d. The nugget only adds to
+// the variance of each sample, so colocated samples remain distinct.
+func (k *Kriging) cov(d float64) float64 {
+  return (1 - k.Nugget) * math.Exp(-3*d/k.Range)
+}
+
+func (k *Kriging) Weights(n int, target func(i int) float64, between func(i, j int) float64) ([]float64, error) {
+  if n == 0 {
+    return nil, nil
+  }
+
+  // the kriging system with a lagrange multiplier to make the weights
+  // sum to one.
+  m := n + 1
+  a := make([][]float64, m)
+  for i := range a {
+    a[i] = make([]float64, m+1)
+  }
+
+  for i := 0; i < n; i++ {
+    for j := 0; j < n; j++ {
+      a[i][j] = k.cov(between(i, j))
+    }
+    a[i][i] += k.Nugget
+    a[i][n] = 1
+    a[n][i] = 1
+    a[i][m] = k.cov(target(i))
+  }
+  a[n][m] = 1
+
+  x, err := solve(a)
+  if err != nil {
+    if k.Nugget == 0 {
+      return nil, fmt.Errorf("%s, are samples colocated without a nugget?", err)
+    }
+    return nil, err
+  }
+  return x[:n], nil
+}
+
+// Solve the augmented m x m+1 system with gaussian elimination and partial
+// pivoting. a is destroyed.
+func solve(a [][]float64) ([]float64, error) {
+  m := len(a)
+  for c := 0; c < m; c++ {
+    p := c
+    for r := c + 1; r < m; r++ {
+      if math.Abs(a[r][c]) > math.Abs(a[p][c]) {
+        p = r
+      }
+    }
+
+    if math.Abs(a[p][c]) < 1e-12 {
+      return nil, fmt.Errorf("singular system")
+    }
+    a[c], a[p] = a[p], a[c]
+
+    for r := c + 1; r < m; r++ {
+      f := a[r][c] / a[c][c]
+      for k := c; k <= m; k++ {
+        a[r][k] -= f * a[c][k]
+      }
+    }
+  }
+
+  x := make([]float64, m)
+  for r := m - 1; r >= 0; r-- {
+    v := a[r][m]
+    for k := r + 1; k < m; k++ {
+      v -= a[r][k] * x[k]
+    }
+    x[r] = v / a[r][r]
+  }
+  return x, nil
+}
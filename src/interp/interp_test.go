@@ -0,0 +1,98 @@
+package interp
+
+import (
+  "math"
+  "testing"
+)
+
+// Samples along a line, the target is at 0.
+var samples = []float64{1, 2, 4, -3}
+
+func target(i int) float64 {
+  return math.Abs(samples[i])
+}
+
+func between(i, j int) float64 {
+  return math.Abs(samples[i] - samples[j])
+}
+
+func TestIDW(t *testing.T) {
+  w, err := (&IDW{Power: 2, Radius: 3.5}).Weights(len(samples), target, between)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  expect := []float64{1, 0.25, 0, 1.0 / 9}
+  for i := range expect {
+    if math.Abs(w[i]-expect[i]) > 1e-12 {
+      t.Errorf("expected weights %v, got %v", expect, w)
+      break
+    }
+  }
+
+  w, _ = (&IDW{Power: 2}).Weights(2, func(i int) float64 {
+    return float64(i)
+  }, between)
+  if w[0] != 1 || w[1] != 0 {
+    t.Errorf("expected a colocated sample to take all weight, got %v", w)
+  }
+}
+
+func TestKriging(t *testing.T) {
+  k := &Kriging{Range: 10, Nugget: 0.1}
+  w, err := k.Weights(len(samples), target, between)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  var sum float64
+  for _, v := range w {
+    sum += v
+  }
+
+  if math.Abs(sum-1) > 1e-9 {
+    t.Errorf("expected weights to sum to 1, got %v", sum)
+  }
+
+  if w[0] <= w[1] || w[1] <= w[2] {
+    t.Errorf("expected nearer samples to have more weight, got %v", w)
+  }
+
+  // without a nugget, kriging is exact at a sample
+  k = &Kriging{Range: 10}
+  w, err = k.Weights(len(samples), func(i int) float64 {
+    return math.Abs(samples[i] - 2)
+  }, between)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if math.Abs(w[1]-1) > 1e-9 {
+    t.Errorf("expected all weight at the sample, got %v", w)
+  }
+}
+
+func TestKrigingColocated(t *testing.T) {
+  // the first two samples are at the same place, as when a site is listed
+  // under more than one id.
+  at := []float64{1, 1, 3}
+  target := func(i int) float64 {
+    return at[i]
+  }
+  between := func(i, j int) float64 {
+    return math.Abs(at[i] - at[j])
+  }
+
+  w, err := (&Kriging{Range: 10, Nugget: 0.1}).Weights(len(at), target, between)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if math.Abs(w[0]-w[1]) > 1e-9 || math.Abs(w[0]+w[1]+w[2]-1) > 1e-9 {
+    t.Errorf("expected colocated samples to share weight, got %v", w)
+  }
+
+  if _, err := (&Kriging{Range: 10}).Weights(len(at), target, between); err == nil {
+    t.Error("expected an error for colocated samples without a nugget")
+  }
+}
@@ -0,0 +1,185 @@
+// Package projection provides map projections between lat/lon (in degrees)
+// and planar x/y (in meters, x to the east and y to the north).
+package projection
+
+import (
+  "fmt"
+  "math"
+  "sort"
+)
+
+// The mean radius of the earth in meters.
+const EarthRadius = 6371007.0
+
+type Projection interface {
+  // Project the point lat, lon onto the plane.
+  Forward(lat, lon float64) (float64, float64)
+
+  // Recover lat, lon from a point on the plane.
+  Inverse(x, y float64) (float64, float64)
+}
+
+func toRadians(d float64) float64 {
+  return d * math.Pi / 180
+}
+
+func toDegrees(r float64) float64 {
+  return r * 180 / math.Pi
+}
+
+// Albers Equal Area Conic on a sphere. Areas on the plane are proportional
+// to areas on the globe.
+type Albers struct {
+  lon0 float64
+  n    float64
+  c    float64
+  rho0 float64
+}
+
+// Create an Albers projection with origin lat0, lon0 and the standard
+// parallels lat1 and lat2.
+func NewAlbers(lat0, lon0, lat1, lat2 float64) *Albers {
+  p0, p1, p2 := toRadians(lat0), toRadians(lat1), toRadians(lat2)
+  n := (math.Sin(p1) + math.Sin(p2)) / 2
+  c := math.Cos(p1)*math.Cos(p1) + 2*n*math.Sin(p1)
+  return &Albers{
+    lon0: toRadians(lon0),
+    n:    n,
+    c:    c,
+    rho0: EarthRadius * math.Sqrt(c-2*n*math.Sin(p0)) / n,
+  }
+}
+
+// The standard Albers projection for the continental US.
+func NewAlbersUsa() *Albers {
+  return NewAlbers(23, -96, 29.5, 45.5)
+}
+
+func (a *Albers) Forward(lat, lon float64) (float64, float64) {
+  rho := EarthRadius * math.Sqrt(a.c-2*a.n*math.Sin(toRadians(lat))) / a.n
+  theta := a.n * (toRadians(lon) - a.lon0)
+  return rho * math.Sin(theta), a.rho0 - rho*math.Cos(theta)
+}
+
+func (a *Albers) Inverse(x, y float64) (float64, float64) {
+  dy := a.rho0 - y
+  rho := math.Hypot(x, dy)
+  theta := math.Atan2(x, dy)
+  if a.n < 0 {
+    rho = -rho
+    theta = math.Atan2(-x, -dy)
+  }
+
+  r := rho * a.n / EarthRadius
+  lat := math.Asin((a.c - r*r) / (2 * a.n))
+  lon := a.lon0 + theta/a.n
+  return toDegrees(lat), toDegrees(lon)
+}
+
+// The spherical Mercator projection used by most web maps.
+type WebMercator struct{}
+
+// The radius used by web mercator, which is the equatorial radius of WGS84.
+const webMercatorRadius = 6378137.0
+
+func (WebMercator) Forward(lat, lon float64) (float64, float64) {
+  return webMercatorRadius * toRadians(lon),
+    webMercatorRadius * math.Log(math.Tan(math.Pi/4+toRadians(lat)/2))
+}
+
+func (WebMercator) Inverse(x, y float64) (float64, float64) {
+  return toDegrees(2*math.Atan(math.Exp(y/webMercatorRadius)) - math.Pi/2),
+    toDegrees(x / webMercatorRadius)
+}
+
+// The equirectangular projection, which maps lat and lon linearly with
+// true scale along the parallel Lat0.
+type Equirectangular struct {
+  Lat0 float64
+  Lon0 float64
+}
+
+func (e *Equirectangular) Forward(lat, lon float64) (float64, float64) {
+  return EarthRadius * toRadians(lon-e.Lon0) * math.Cos(toRadians(e.Lat0)),
+    EarthRadius * toRadians(lat)
+}
+
+func (e *Equirectangular) Inverse(x, y float64) (float64, float64) {
+  return toDegrees(y / EarthRadius),
+    e.Lon0 + toDegrees(x/(EarthRadius*math.Cos(toRadians(e.Lat0))))
+}
+
+// Maps lat, lon to virtual coordinates, which are the projected coordinates
+// offset, scaled and flipped so that y increases to the south.
+type Transform struct {
+  p    Projection
+  minX float64
+  maxY float64
+  f    float64
+}
+
+// Create a transform that places the projected point (minX, maxY) at the
+// origin and scales by f virtual units per meter.
+func NewTransform(p Projection, minX, maxY, f float64) *Transform {
+  return &Transform{
+    p:    p,
+    minX: minX,
+    maxY: maxY,
+    f:    f,
+  }
+}
+
+func (t *Transform) Forward(lat, lon float64) (float64, float64) {
+  x, y := t.p.Forward(lat, lon)
+  return (x - t.minX) * t.f, (t.maxY - y) * t.f
+}
+
+func (t *Transform) Inverse(x, y float64) (float64, float64) {
+  return t.p.Inverse(x/t.f+t.minX, t.maxY-y/t.f)
+}
+
+// Compute a transform in which the projected extent of the n points (the ith
+// of which is given by at) is scaled to the given width.
+func Fit(p Projection, width float64, n int, at func(i int) (float64, float64)) *Transform {
+  minX, minY := math.Inf(1), math.Inf(1)
+  maxX, maxY := math.Inf(-1), math.Inf(-1)
+  for i := 0; i < n; i++ {
+    x, y := p.Forward(at(i))
+    minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+    minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+  }
+
+  return NewTransform(p, minX, maxY, width/(maxX-minX))
+}
+
+// The projections that can be selected by name.
+var named = map[string]func() Projection{
+  "albers": func() Projection {
+    return NewAlbersUsa()
+  },
+  "mercator": func() Projection {
+    return WebMercator{}
+  },
+  "equirectangular": func() Projection {
+    return &Equirectangular{}
+  },
+}
+
+// Names of all of the projections that are available through ByName.
+func Names() []string {
+  var names []string
+  for name, _ := range named {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  return names
+}
+
+// Find a projection by name, see Names.
+func ByName(name string) (Projection, error) {
+  f := named[name]
+  if f == nil {
+    return nil, fmt.Errorf("unknown projection: %s", name)
+  }
+  return f(), nil
+}
@@ -0,0 +1,103 @@
+package projection
+
+import (
+  "math"
+  "testing"
+)
+
+var points = [][2]float64{
+  {38.9, -77.0},
+  {47.6, -122.3},
+  {25.8, -80.2},
+  {39.7, -105.0},
+}
+
+func TestRoundTrip(t *testing.T) {
+  for _, name := range Names() {
+    p, err := ByName(name)
+    if err != nil {
+      t.Fatal(err)
+    }
+
+    for _, pt := range points {
+      x, y := p.Forward(pt[0], pt[1])
+      lat, lon := p.Inverse(x, y)
+      if math.Abs(lat-pt[0]) > 1e-9 || math.Abs(lon-pt[1]) > 1e-9 {
+        t.Errorf("%s: %v became %v, %v", name, pt, lat, lon)
+      }
+    }
+  }
+}
+
+func TestAlbersIsEqualArea(t *testing.T) {
+  p := NewAlbersUsa()
+
+  // the area of a 1 degree square on the plane, the edges are traced
+  // finely since parallels are arcs under the projection.
+  area := func(lat, lon float64) float64 {
+    var xs, ys []float64
+    trace := func(lat0, lon0, lat1, lon1 float64) {
+      for i := 0; i < 100; i++ {
+        f := float64(i) / 100
+        x, y := p.Forward(lat0+(lat1-lat0)*f, lon0+(lon1-lon0)*f)
+        xs = append(xs, x)
+        ys = append(ys, y)
+      }
+    }
+    trace(lat, lon, lat, lon+1)
+    trace(lat, lon+1, lat+1, lon+1)
+    trace(lat+1, lon+1, lat+1, lon)
+    trace(lat+1, lon, lat, lon)
+
+    var a float64
+    for i := range xs {
+      j := (i + 1) % len(xs)
+      a += xs[i]*ys[j] - xs[j]*ys[i]
+    }
+    return math.Abs(a) / 2
+  }
+
+  // the same square on the sphere
+  sphere := func(lat float64) float64 {
+    return EarthRadius * EarthRadius * toRadians(1) *
+      (math.Sin(toRadians(lat+1)) - math.Sin(toRadians(lat)))
+  }
+
+  for _, lat := range []float64{25, 35, 48} {
+    a, s := area(lat, -96), sphere(lat)
+    if math.Abs(a-s)/s > 0.001 {
+      t.Errorf("expected area %v at %v, got %v", s, lat, a)
+    }
+  }
+}
+
+func TestUnknown(t *testing.T) {
+  if _, err := ByName("dymaxion"); err == nil {
+    t.Errorf("expected an error for an unknown projection")
+  }
+}
+
+func TestFit(t *testing.T) {
+  p := NewAlbersUsa()
+  tx := Fit(p, 1000, len(points), func(i int) (float64, float64) {
+    return points[i][0], points[i][1]
+  })
+
+  minX, maxX := math.Inf(1), math.Inf(-1)
+  for _, pt := range points {
+    x, y := tx.Forward(pt[0], pt[1])
+    if y < -1e-9 {
+      t.Errorf("expected %v to be below the top, got y = %v", pt, y)
+    }
+    minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+
+    lat, lon := tx.Inverse(x, y)
+    if math.Abs(lat-pt[0]) > 1e-9 || math.Abs(lon-pt[1]) > 1e-9 {
+      t.Errorf("%v became %v, %v", pt, lat, lon)
+    }
+  }
+
+  if math.Abs(minX) > 1e-9 || math.Abs(maxX-1000) > 1e-9 {
+    t.Errorf("expected x to span [0, 1000], got [%v, %v]", minX, maxX)
+  }
+}
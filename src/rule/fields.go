@@ -0,0 +1,60 @@
+package rule
+
+import (
+  "coriolis"
+)
+
+// A numeric field of a summary, which is missing unless the summary has
+// all of the fields in has.
+type numField struct {
+  has coriolis.Field
+  get func(s *coriolis.Summary) float64
+}
+
+// The numeric fields of coriolis.Summary that may be referenced in a rule.
+var numFields = map[string]*numField{
+  "TempAvg":          {coriolis.FieldTempAvg, func(s *coriolis.Summary) float64 { return s.TempAvg }},
+  "TempMax":          {coriolis.FieldTempMax, func(s *coriolis.Summary) float64 { return s.TempMax }},
+  "TempMin":          {coriolis.FieldTempMin, func(s *coriolis.Summary) float64 { return s.TempMin }},
+  "DewPoint":         {coriolis.FieldDewPoint, func(s *coriolis.Summary) float64 { return s.DewPoint }},
+  "SeaLevelPressure": {coriolis.FieldSeaLevelPressure, func(s *coriolis.Summary) float64 { return s.SeaLevelPressure }},
+  "StationPressure":  {coriolis.FieldStationPressure, func(s *coriolis.Summary) float64 { return s.StationPressure }},
+  "Visibility":       {coriolis.FieldVisibility, func(s *coriolis.Summary) float64 { return s.Visibility }},
+  "WindAvg":          {coriolis.FieldWindAvg, func(s *coriolis.Summary) float64 { return s.WindAvg }},
+  "WindMax":          {coriolis.FieldWindMax, func(s *coriolis.Summary) float64 { return s.WindMax }},
+  "Gust":             {coriolis.FieldGust, func(s *coriolis.Summary) float64 { return s.Gust }},
+  "Precip":           {coriolis.FieldPrecip, func(s *coriolis.Summary) float64 { return s.Precip }},
+  "SnowDepth":        {coriolis.FieldSnowDepth, func(s *coriolis.Summary) float64 { return s.SnowDepth }},
+
+  "TempAvgCount":          {0, func(s *coriolis.Summary) float64 { return float64(s.TempAvgCount) }},
+  "DewPointCount":         {0, func(s *coriolis.Summary) float64 { return float64(s.DewPointCount) }},
+  "SeaLevelPressureCount": {0, func(s *coriolis.Summary) float64 { return float64(s.SeaLevelPressureCount) }},
+  "StationPressureCount":  {0, func(s *coriolis.Summary) float64 { return float64(s.StationPressureCount) }},
+  "VisibilityCount":       {0, func(s *coriolis.Summary) float64 { return float64(s.VisibilityCount) }},
+  "WindAvgCount":          {0, func(s *coriolis.Summary) float64 { return float64(s.WindAvgCount) }},
+  "PrecipHours":           {0, func(s *coriolis.Summary) float64 { return float64(s.PrecipHours()) }},
+
+  "HeatIndex": {coriolis.FieldTempAvg | coriolis.FieldDewPoint, func(s *coriolis.Summary) float64 {
+    v, _ := s.HeatIndex()
+    return v
+  }},
+  "WindChill": {coriolis.FieldTempAvg | coriolis.FieldWindAvg, func(s *coriolis.Summary) float64 {
+    v, _ := s.WindChill()
+    return v
+  }},
+  "ApparentTemp": {coriolis.FieldTempAvg, func(s *coriolis.Summary) float64 { return s.ApparentTemp(s.TempAvg) }},
+}
+
+// The boolean fields of coriolis.Summary that may be referenced in a rule. These
+// are never missing.
+var boolFields = map[string]func(s *coriolis.Summary) bool{
+  "Fog":            func(s *coriolis.Summary) bool { return s.Had(coriolis.EventFog) },
+  "Rain":           func(s *coriolis.Summary) bool { return s.Had(coriolis.EventRain) },
+  "Snow":           func(s *coriolis.Summary) bool { return s.Had(coriolis.EventSnow) },
+  "Hail":           func(s *coriolis.Summary) bool { return s.Had(coriolis.EventHail) },
+  "Thunder":        func(s *coriolis.Summary) bool { return s.Had(coriolis.EventThunder) },
+  "Tornado":        func(s *coriolis.Summary) bool { return s.Had(coriolis.EventTornado) },
+  "TempMaxDerived": func(s *coriolis.Summary) bool { return s.TempMaxDerived },
+  "TempMinDerived": func(s *coriolis.Summary) bool { return s.TempMinDerived },
+  "PrecipComplete": func(s *coriolis.Summary) bool { return s.PrecipComplete() },
+}
@@ -0,0 +1,79 @@
+package rule
+
+import (
+  "fmt"
+  "strings"
+  "unicode"
+)
+
+type tokenKind int
+
+const (
+  tokEOF tokenKind = iota
+  tokNum
+  tokIdent
+  tokOp
+)
+
+type token struct {
+  kind tokenKind
+  text string
+  pos  int
+}
+
+// Identifiers that are reserved words, these are case-insensitive.
+var keywords = map[string]bool{
+  "and":     true,
+  "or":      true,
+  "not":     true,
+  "between": true,
+  "true":    true,
+  "false":   true,
+}
+
+// Break the source of a rule into tokens.
+func lex(src string) ([]token, error) {
+  var toks []token
+  i := 0
+  for i < len(src) {
+    c := rune(src[i])
+    switch {
+    case unicode.IsSpace(c):
+      i++
+    case unicode.IsDigit(c) || c == '.':
+      j := i
+      for j < len(src) && (unicode.IsDigit(rune(src[j])) || src[j] == '.') {
+        j++
+      }
+      toks = append(toks, token{tokNum, src[i:j], i})
+      i = j
+    case unicode.IsLetter(c) || c == '_':
+      j := i
+      for j < len(src) && (unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j])) || src[j] == '_') {
+        j++
+      }
+      text := src[i:j]
+      if keywords[strings.ToLower(text)] {
+        text = strings.ToLower(text)
+      }
+      toks = append(toks, token{tokIdent, text, i})
+      i = j
+    case strings.ContainsRune("<>=!", c):
+      if i+1 < len(src) && src[i+1] == '=' {
+        toks = append(toks, token{tokOp, src[i : i+2], i})
+        i += 2
+      } else if c == '<' || c == '>' {
+        toks = append(toks, token{tokOp, src[i : i+1], i})
+        i++
+      } else {
+        return nil, &Error{i, fmt.Sprintf("unexpected %q", c)}
+      }
+    case strings.ContainsRune("+-*/(),", c):
+      toks = append(toks, token{tokOp, src[i : i+1], i})
+      i++
+    default:
+      return nil, &Error{i, fmt.Sprintf("unexpected %q", c)}
+    }
+  }
+  return append(toks, token{tokEOF, "", len(src)}), nil
+}
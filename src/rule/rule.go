@@ -0,0 +1,617 @@
+// Package rule implements a small expression language for deciding whether
+// a day (a coriolis.Summary) is pleasant. For example,
+//
+//	TempAvg between 60 and 78 and DewPoint < 60 and WindMax < 20 and not Thunder
+//
+// Rules are made of the numeric and boolean fields of coriolis.Summary, number
+// literals, arithmetic (+ - * /), comparisons (< <= > >= == !=), the range
+// test "x between a and b" and the logical operators and, or & not. The
+// builtin has(Field) tests whether a numeric field was reported. The derived
+// HeatIndex, WindChill and ApparentTemp may be used like any other field.
+//
+// A comparison involving a missing field is neither true nor false and
+// logical operators follow three-valued logic. A rule that evaluates to
+// unknown is considered satisfied, just as a missing value never rules out
+// a day.
+package rule
+
+import (
+  "coriolis"
+  "fmt"
+  "strconv"
+)
+
+// An error in the source of a rule, Pos is the byte offset of the problem.
+type Error struct {
+  Pos int
+  Msg string
+}
+
+func (e *Error) Error() string {
+  return fmt.Sprintf("%d: %s", e.Pos+1, e.Msg)
+}
+
+// The result of a logical expression, which may be unknown when it involves
+// missing data.
+type tri int8
+
+const (
+  triFalse tri = iota
+  triTrue
+  triUnknown
+)
+
+func toTri(b bool) tri {
+  if b {
+    return triTrue
+  }
+  return triFalse
+}
+
+// Three-valued conjunction.
+func and3(x, y tri) tri {
+  if x == triFalse || y == triFalse {
+    return triFalse
+  }
+  if x == triUnknown || y == triUnknown {
+    return triUnknown
+  }
+  return triTrue
+}
+
+// Three-valued disjunction.
+func or3(x, y tri) tri {
+  if x == triTrue || y == triTrue {
+    return triTrue
+  }
+  if x == triUnknown || y == triUnknown {
+    return triUnknown
+  }
+  return triFalse
+}
+
+type exprType int
+
+const (
+  typeNum exprType = iota
+  typeBool
+)
+
+func (t exprType) String() string {
+  if t == typeNum {
+    return "number"
+  }
+  return "boolean"
+}
+
+// A type-checked expression. Exactly one of num and cond is set according
+// to typ. Numeric expressions report false when their value is missing.
+type expr struct {
+  typ  exprType
+  pos  int
+  num  func(s *coriolis.Summary) (float64, bool)
+  cond func(s *coriolis.Summary) tri
+}
+
+// A compiled rule.
+type Rule struct {
+  src  string
+  cond func(s *coriolis.Summary) tri
+}
+
+// Parse and type-check the source of a rule.
+func Parse(src string) (*Rule, error) {
+  toks, err := lex(src)
+  if err != nil {
+    return nil, err
+  }
+
+  p := &parser{toks: toks}
+  e, err := p.parseOr()
+  if err != nil {
+    return nil, err
+  }
+
+  if t := p.peek(); t.kind != tokEOF {
+    return nil, &Error{t.pos, fmt.Sprintf("unexpected %q", t.text)}
+  }
+
+  if e.typ != typeBool {
+    return nil, &Error{e.pos, "rule must be a boolean expression"}
+  }
+
+  return &Rule{
+    src:  src,
+    cond: e.cond,
+  }, nil
+}
+
+// Parse a rule, panicking if it is invalid.
+func MustParse(src string) *Rule {
+  r, err := Parse(src)
+  if err != nil {
+    panic(err)
+  }
+  return r
+}
+
+// Evaluate the rule for the given summary. Unknown results are considered
+// satisfied.
+func (r *Rule) Eval(s *coriolis.Summary) bool {
+  return r.cond(s) != triFalse
+}
+
+func (r *Rule) String() string {
+  return r.src
+}
+
+type parser struct {
+  toks []token
+  i    int
+}
+
+func (p *parser) peek() token {
+  return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+  t := p.toks[p.i]
+  if t.kind != tokEOF {
+    p.i++
+  }
+  return t
+}
+
+// Consume the next token if it is the given keyword or operator.
+func (p *parser) accept(text string) bool {
+  t := p.peek()
+  if (t.kind == tokIdent || t.kind == tokOp) && t.text == text {
+    p.i++
+    return true
+  }
+  return false
+}
+
+func (p *parser) expect(text string) error {
+  if !p.accept(text) {
+    t := p.peek()
+    if t.kind == tokEOF {
+      return &Error{t.pos, fmt.Sprintf("expected %q", text)}
+    }
+    return &Error{t.pos, fmt.Sprintf("expected %q, found %q", text, t.text)}
+  }
+  return nil
+}
+
+func mustBe(e *expr, typ exprType) error {
+  if e.typ != typ {
+    return &Error{e.pos, fmt.Sprintf("expected %s expression, found %s", typ, e.typ)}
+  }
+  return nil
+}
+
+// or := and ("or" and)*
+func (p *parser) parseOr() (*expr, error) {
+  e, err := p.parseAnd()
+  if err != nil {
+    return nil, err
+  }
+
+  for p.accept("or") {
+    r, err := p.parseAnd()
+    if err != nil {
+      return nil, err
+    }
+
+    if err := mustBe(e, typeBool); err != nil {
+      return nil, err
+    }
+
+    if err := mustBe(r, typeBool); err != nil {
+      return nil, err
+    }
+
+    a, b := e.cond, r.cond
+    e = &expr{
+      typ: typeBool,
+      pos: e.pos,
+      cond: func(s *coriolis.Summary) tri {
+        return or3(a(s), b(s))
+      },
+    }
+  }
+
+  return e, nil
+}
+
+// and := not ("and" not)*
+func (p *parser) parseAnd() (*expr, error) {
+  e, err := p.parseNot()
+  if err != nil {
+    return nil, err
+  }
+
+  for p.accept("and") {
+    r, err := p.parseNot()
+    if err != nil {
+      return nil, err
+    }
+
+    if err := mustBe(e, typeBool); err != nil {
+      return nil, err
+    }
+
+    if err := mustBe(r, typeBool); err != nil {
+      return nil, err
+    }
+
+    a, b := e.cond, r.cond
+    e = &expr{
+      typ: typeBool,
+      pos: e.pos,
+      cond: func(s *coriolis.Summary) tri {
+        return and3(a(s), b(s))
+      },
+    }
+  }
+
+  return e, nil
+}
+
+// not := "not" not | cmp
+func (p *parser) parseNot() (*expr, error) {
+  t := p.peek()
+  if !p.accept("not") {
+    return p.parseCmp()
+  }
+
+  e, err := p.parseNot()
+  if err != nil {
+    return nil, err
+  }
+
+  if err := mustBe(e, typeBool); err != nil {
+    return nil, err
+  }
+
+  a := e.cond
+  return &expr{
+    typ: typeBool,
+    pos: t.pos,
+    cond: func(s *coriolis.Summary) tri {
+      switch a(s) {
+      case triTrue:
+        return triFalse
+      case triFalse:
+        return triTrue
+      }
+      return triUnknown
+    },
+  }, nil
+}
+
+// Build a comparison of two numeric expressions.
+func compare(op string, pos int, a, b func(s *coriolis.Summary) (float64, bool)) *expr {
+  var f func(x, y float64) bool
+  switch op {
+  case "<":
+    f = func(x, y float64) bool { return x < y }
+  case "<=":
+    f = func(x, y float64) bool { return x <= y }
+  case ">":
+    f = func(x, y float64) bool { return x > y }
+  case ">=":
+    f = func(x, y float64) bool { return x >= y }
+  case "==":
+    f = func(x, y float64) bool { return x == y }
+  case "!=":
+    f = func(x, y float64) bool { return x != y }
+  }
+
+  return &expr{
+    typ: typeBool,
+    pos: pos,
+    cond: func(s *coriolis.Summary) tri {
+      x, ok := a(s)
+      if !ok {
+        return triUnknown
+      }
+      y, ok := b(s)
+      if !ok {
+        return triUnknown
+      }
+      return toTri(f(x, y))
+    },
+  }
+}
+
+// cmp := sum (("<" | "<=" | ">" | ">=" | "==" | "!=") sum)?
+//
+//	| sum "between" sum "and" sum
+func (p *parser) parseCmp() (*expr, error) {
+  e, err := p.parseSum()
+  if err != nil {
+    return nil, err
+  }
+
+  t := p.peek()
+  switch {
+  case t.kind == tokOp && (t.text == "<" || t.text == "<=" || t.text == ">" ||
+    t.text == ">=" || t.text == "==" || t.text == "!="):
+    p.next()
+    r, err := p.parseSum()
+    if err != nil {
+      return nil, err
+    }
+
+    if err := mustBe(e, typeNum); err != nil {
+      return nil, err
+    }
+
+    if err := mustBe(r, typeNum); err != nil {
+      return nil, err
+    }
+
+    return compare(t.text, e.pos, e.num, r.num), nil
+  case t.kind == tokIdent && t.text == "between":
+    p.next()
+    lo, err := p.parseSum()
+    if err != nil {
+      return nil, err
+    }
+
+    if err := p.expect("and"); err != nil {
+      return nil, err
+    }
+
+    hi, err := p.parseSum()
+    if err != nil {
+      return nil, err
+    }
+
+    for _, x := range []*expr{e, lo, hi} {
+      if err := mustBe(x, typeNum); err != nil {
+        return nil, err
+      }
+    }
+
+    a, b := compare(">=", e.pos, e.num, lo.num), compare("<=", e.pos, e.num, hi.num)
+    return &expr{
+      typ: typeBool,
+      pos: e.pos,
+      cond: func(s *coriolis.Summary) tri {
+        return and3(a.cond(s), b.cond(s))
+      },
+    }, nil
+  }
+
+  return e, nil
+}
+
+// Build an arithmetic operation on two numeric expressions.
+func arith(op string, pos int, a, b func(s *coriolis.Summary) (float64, bool)) *expr {
+  var f func(x, y float64) float64
+  switch op {
+  case "+":
+    f = func(x, y float64) float64 { return x + y }
+  case "-":
+    f = func(x, y float64) float64 { return x - y }
+  case "*":
+    f = func(x, y float64) float64 { return x * y }
+  case "/":
+    f = func(x, y float64) float64 { return x / y }
+  }
+
+  return &expr{
+    typ: typeNum,
+    pos: pos,
+    num: func(s *coriolis.Summary) (float64, bool) {
+      x, ok := a(s)
+      if !ok {
+        return 0, false
+      }
+      y, ok := b(s)
+      if !ok {
+        return 0, false
+      }
+      return f(x, y), true
+    },
+  }
+}
+
+// sum := product (("+" | "-") product)*
+func (p *parser) parseSum() (*expr, error) {
+  e, err := p.parseProduct()
+  if err != nil {
+    return nil, err
+  }
+
+  for {
+    t := p.peek()
+    if t.kind != tokOp || (t.text != "+" && t.text != "-") {
+      return e, nil
+    }
+    p.next()
+
+    r, err := p.parseProduct()
+    if err != nil {
+      return nil, err
+    }
+
+    if err := mustBe(e, typeNum); err != nil {
+      return nil, err
+    }
+
+    if err := mustBe(r, typeNum); err != nil {
+      return nil, err
+    }
+
+    e = arith(t.text, e.pos, e.num, r.num)
+  }
+}
+
+// product := unary (("*" | "/") unary)*
+func (p *parser) parseProduct() (*expr, error) {
+  e, err := p.parseUnary()
+  if err != nil {
+    return nil, err
+  }
+
+  for {
+    t := p.peek()
+    if t.kind != tokOp || (t.text != "*" && t.text != "/") {
+      return e, nil
+    }
+    p.next()
+
+    r, err := p.parseUnary()
+    if err != nil {
+      return nil, err
+    }
+
+    if err := mustBe(e, typeNum); err != nil {
+      return nil, err
+    }
+
+    if err := mustBe(r, typeNum); err != nil {
+      return nil, err
+    }
+
+    e = arith(t.text, e.pos, e.num, r.num)
+  }
+}
+
+// unary := "-" unary | primary
+func (p *parser) parseUnary() (*expr, error) {
+  t := p.peek()
+  if !p.accept("-") {
+    return p.parsePrimary()
+  }
+
+  e, err := p.parseUnary()
+  if err != nil {
+    return nil, err
+  }
+
+  if err := mustBe(e, typeNum); err != nil {
+    return nil, err
+  }
+
+  a := e.num
+  return &expr{
+    typ: typeNum,
+    pos: t.pos,
+    num: func(s *coriolis.Summary) (float64, bool) {
+      x, ok := a(s)
+      return -x, ok
+    },
+  }, nil
+}
+
+// primary := number | "true" | "false" | field | "has" "(" field ")" | "(" or ")"
+func (p *parser) parsePrimary() (*expr, error) {
+  t := p.next()
+  switch t.kind {
+  case tokNum:
+    v, err := strconv.ParseFloat(t.text, 64)
+    if err != nil {
+      return nil, &Error{t.pos, fmt.Sprintf("invalid number %q", t.text)}
+    }
+    return &expr{
+      typ: typeNum,
+      pos: t.pos,
+      num: func(s *coriolis.Summary) (float64, bool) {
+        return v, true
+      },
+    }, nil
+  case tokIdent:
+    switch t.text {
+    case "true", "false":
+      v := toTri(t.text == "true")
+      return &expr{
+        typ: typeBool,
+        pos: t.pos,
+        cond: func(s *coriolis.Summary) tri {
+          return v
+        },
+      }, nil
+    case "has":
+      return p.parseHas(t)
+    }
+    return fieldExpr(t)
+  case tokOp:
+    if t.text == "(" {
+      e, err := p.parseOr()
+      if err != nil {
+        return nil, err
+      }
+
+      if err := p.expect(")"); err != nil {
+        return nil, err
+      }
+
+      return e, nil
+    }
+  case tokEOF:
+    return nil, &Error{t.pos, "unexpected end of rule"}
+  }
+
+  return nil, &Error{t.pos, fmt.Sprintf("unexpected %q", t.text)}
+}
+
+// has := "has" "(" field ")", where the field is numeric.
+func (p *parser) parseHas(t token) (*expr, error) {
+  if err := p.expect("("); err != nil {
+    return nil, err
+  }
+
+  n := p.next()
+  f := numFields[n.text]
+  if n.kind != tokIdent || f == nil {
+    return nil, &Error{n.pos, fmt.Sprintf("has expects a numeric field, found %q", n.text)}
+  }
+
+  if err := p.expect(")"); err != nil {
+    return nil, err
+  }
+
+  return &expr{
+    typ: typeBool,
+    pos: t.pos,
+    cond: func(s *coriolis.Summary) tri {
+      return toTri(s.Has(f.has))
+    },
+  }, nil
+}
+
+// Resolve a field reference.
+func fieldExpr(t token) (*expr, error) {
+  if f := numFields[t.text]; f != nil {
+    return &expr{
+      typ: typeNum,
+      pos: t.pos,
+      num: func(s *coriolis.Summary) (float64, bool) {
+        if !s.Has(f.has) {
+          return 0, false
+        }
+        return f.get(s), true
+      },
+    }, nil
+  }
+
+  if f := boolFields[t.text]; f != nil {
+    return &expr{
+      typ: typeBool,
+      pos: t.pos,
+      cond: func(s *coriolis.Summary) tri {
+        return toTri(f(s))
+      },
+    }, nil
+  }
+
+  if keywords[t.text] {
+    return nil, &Error{t.pos, fmt.Sprintf("unexpected %q", t.text)}
+  }
+
+  return nil, &Error{t.pos, fmt.Sprintf("unknown field %s", t.text)}
+}
@@ -0,0 +1,115 @@
+package rule
+
+import (
+  "coriolis"
+  "testing"
+)
+
+// A day in the summer with a passing thunderstorm.
+var stormy = &coriolis.Summary{
+  TempAvg:  72,
+  TempMax:  84,
+  TempMin:  63,
+  DewPoint: 65,
+  WindAvg:  8,
+  WindMax:  22,
+  Precip:   0.4,
+  Events:   coriolis.EventRain | coriolis.EventThunder,
+  Valid: coriolis.FieldTempAvg | coriolis.FieldTempMax | coriolis.FieldTempMin |
+    coriolis.FieldDewPoint | coriolis.FieldWindAvg | coriolis.FieldWindMax | coriolis.FieldPrecip,
+}
+
+// A mild, dry day in spring with no dew point reported.
+var mild = &coriolis.Summary{
+  TempAvg: 66,
+  TempMax: 74,
+  TempMin: 55,
+  WindAvg: 6,
+  WindMax: 12,
+  Valid: coriolis.FieldTempAvg | coriolis.FieldTempMax | coriolis.FieldTempMin |
+    coriolis.FieldWindAvg | coriolis.FieldWindMax | coriolis.FieldPrecip,
+}
+
+var evalTests = []struct {
+  rule   string
+  day    *coriolis.Summary
+  expect bool
+}{
+  {"TempAvg between 60 and 78", stormy, true},
+  {"TempAvg between 60 and 70", stormy, false},
+  {"TempAvg BETWEEN 60 AND 78 AND DewPoint < 60 AND WindMax < 20 AND NOT Thunder", stormy, false},
+  {"TempAvg between 60 and 78 and DewPoint < 60 and WindMax < 20 and not Thunder", mild, true},
+  {"Rain or Snow", stormy, true},
+  {"Rain or Snow", mild, false},
+  {"not (Rain or Snow)", mild, true},
+  {"TempMax - TempMin > 20", stormy, true},
+  {"(TempMax + TempMin) / 2 >= 70", mild, false},
+  {"-TempMin < -60", stormy, true},
+  {"Precip == 0", mild, true},
+  {"Precip != 0", stormy, true},
+  {"true", mild, true},
+  {"false or TempAvg > 0", mild, true},
+
+  {"ApparentTemp > TempAvg", stormy, false},
+  {"HeatIndex < 75", stormy, true},
+  {"WindChill < 0", mild, false},
+
+  // missing values are unknown, which never rules out a day
+  {"DewPoint < 60", mild, true},
+  {"not (DewPoint < 60)", mild, true},
+  {"DewPoint < 60 and Rain", mild, false},
+  {"DewPoint < 60 or Rain", mild, true},
+  {"SnowDepth * 2 > 1", mild, true},
+
+  // unless the rule asks explicitly
+  {"has(DewPoint) and DewPoint < 60", mild, false},
+  {"has(DewPoint)", stormy, true},
+}
+
+func TestEval(t *testing.T) {
+  for _, test := range evalTests {
+    r, err := Parse(test.rule)
+    if err != nil {
+      t.Errorf("%s: %s", test.rule, err)
+      continue
+    }
+
+    if got := r.Eval(test.day); got != test.expect {
+      t.Errorf("%s: expected %v, got %v", test.rule, test.expect, got)
+    }
+  }
+}
+
+var errorTests = []struct {
+  rule string
+  err  string
+}{
+  {"TempAvgg > 60", "1: unknown field TempAvgg"},
+  {"TempAvg > 60 and Thunderstorm", "18: unknown field Thunderstorm"},
+  {"TempAvg", "1: rule must be a boolean expression"},
+  {"TempAvg > Thunder", "11: expected number expression, found boolean"},
+  {"Rain and 1", "10: expected boolean expression, found number"},
+  {"not TempAvg", "5: expected boolean expression, found number"},
+  {"TempAvg between 60 or 78", "20: expected \"and\", found \"or\""},
+  {"TempAvg > ", "11: unexpected end of rule"},
+  {"(TempAvg > 60", "14: expected \")\""},
+  {"TempAvg > 60 60", "14: unexpected \"60\""},
+  {"TempAvg = 60", "9: unexpected '='"},
+  {"has(Rain)", "5: has expects a numeric field, found \"Rain\""},
+  {"TempAvg > 6.0.0", "11: invalid number \"6.0.0\""},
+  {"TempAvg > 60 and", "17: unexpected end of rule"},
+}
+
+func TestErrors(t *testing.T) {
+  for _, test := range errorTests {
+    _, err := Parse(test.rule)
+    if err == nil {
+      t.Errorf("%s: expected error %q", test.rule, test.err)
+      continue
+    }
+
+    if err.Error() != test.err {
+      t.Errorf("%s: expected error %q, got %q", test.rule, test.err, err.Error())
+    }
+  }
+}
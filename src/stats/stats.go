@@ -0,0 +1,120 @@
+// Package stats provides the statistical tests used in analyzing trends in
+// the yearly data.
+package stats
+
+import (
+  "math"
+)
+
+// A least squares fit of a line, y = Slope*x + Intercept.
+type Fit struct {
+  Slope     float64
+  Intercept float64
+
+  // The coefficient of determination. This is zero when y is constant.
+  R2 float64
+}
+
+// Fit a line to the points (x[i], y[i]). x and y must have the same length
+// and there must be at least two distinct values of x.
+func LinearFit(x, y []float64) Fit {
+  n := float64(len(x))
+
+  var mx, my float64
+  for i := range x {
+    mx += x[i]
+    my += y[i]
+  }
+  mx /= n
+  my /= n
+
+  var sxy, sxx, syy float64
+  for i := range x {
+    dx, dy := x[i]-mx, y[i]-my
+    sxy += dx * dy
+    sxx += dx * dx
+    syy += dy * dy
+  }
+
+  f := Fit{
+    Slope: sxy / sxx,
+  }
+  f.Intercept = my - f.Slope*mx
+
+  if syy > 0 {
+    var res float64
+    for i := range x {
+      d := y[i] - (f.Slope*x[i] + f.Intercept)
+      res += d * d
+    }
+    f.R2 = 1 - res/syy
+  }
+
+  return f
+}
+
+// The result of a Mann-Kendall test for a monotonic trend.
+type MannKendall struct {
+  // The Kendall S statistic, positive for an upward trend.
+  S int
+
+  // The normalized test statistic and its two-sided p-value.
+  Z float64
+  P float64
+}
+
+func sign(v float64) int {
+  switch {
+  case v > 0:
+    return 1
+  case v < 0:
+    return -1
+  }
+  return 0
+}
+
+// Perform the Mann-Kendall test on the series y, which is assumed to be in
+// time order. The variance is corrected for ties.
+func MannKendallTest(y []float64) MannKendall {
+  n := len(y)
+
+  var s int
+  for i := 0; i < n; i++ {
+    for j := i + 1; j < n; j++ {
+      s += sign(y[j] - y[i])
+    }
+  }
+
+  // count the size of each group of tied values
+  ties := map[float64]int{}
+  for _, v := range y {
+    ties[v]++
+  }
+
+  nf := float64(n)
+  v := nf * (nf - 1) * (2*nf + 5)
+  for _, t := range ties {
+    tf := float64(t)
+    v -= tf * (tf - 1) * (2*tf + 5)
+  }
+  v /= 18
+
+  mk := MannKendall{
+    S: s,
+    P: 1,
+  }
+
+  if v <= 0 {
+    return mk
+  }
+
+  switch {
+  case s > 0:
+    mk.Z = float64(s-1) / math.Sqrt(v)
+  case s < 0:
+    mk.Z = float64(s+1) / math.Sqrt(v)
+  }
+
+  mk.P = math.Erfc(math.Abs(mk.Z) / math.Sqrt2)
+  return mk
+}
@@ -0,0 +1,42 @@
+package stats
+
+import (
+  "math"
+  "testing"
+)
+
+func TestLinearFit(t *testing.T) {
+  x := []float64{1990, 1991, 1992, 1993, 1994}
+  y := []float64{10, 12, 14, 16, 18}
+
+  f := LinearFit(x, y)
+  if math.Abs(f.Slope-2) > 1e-9 || math.Abs(f.R2-1) > 1e-9 {
+    t.Errorf("expected slope 2 & r2 1, got %v", f)
+  }
+
+  if v := f.Slope*1995 + f.Intercept; math.Abs(v-20) > 1e-6 {
+    t.Errorf("expected 20 in 1995, got %v", v)
+  }
+
+  f = LinearFit(x, []float64{3, 3, 3, 3, 3})
+  if f.Slope != 0 || f.R2 != 0 {
+    t.Errorf("expected a flat fit, got %v", f)
+  }
+}
+
+func TestMannKendall(t *testing.T) {
+  up := MannKendallTest([]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+  if up.S != 45 || up.P > 0.001 {
+    t.Errorf("expected a significant upward trend, got %v", up)
+  }
+
+  down := MannKendallTest([]float64{5, 4, 4, 3, 1})
+  if down.S != -9 || down.Z >= 0 {
+    t.Errorf("expected a downward trend, got %v", down)
+  }
+
+  flat := MannKendallTest([]float64{2, 1, 2, 1, 2, 1})
+  if flat.P < 0.5 {
+    t.Errorf("expected no trend, got %v", flat)
+  }
+}
@@ -1,41 +1,105 @@
 package util
 
+import (
+  "context"
+  "sync"
+)
+
+// Runs functions on a fixed number of goroutines. The first function to
+// return an error cancels the worker, any jobs that have not yet started
+// are abandoned and the error is returned from WaitForExit.
 type Worker struct {
   n int
   c chan func() error
   e chan bool
+
+  ctx    context.Context
+  cancel context.CancelFunc
+
+  lck  sync.Mutex
+  errs []error
 }
 
 func StartWorker(n int) *Worker {
-  c := make(chan func() error)
-  e := make(chan bool)
+  return StartWorkerWithContext(context.Background(), n)
+}
+
+// Start a worker that is also cancelled when ctx is done.
+func StartWorkerWithContext(ctx context.Context, n int) *Worker {
+  ctx, cancel := context.WithCancel(ctx)
+  w := &Worker{
+    n:      n,
+    c:      make(chan func() error),
+    e:      make(chan bool),
+    ctx:    ctx,
+    cancel: cancel,
+  }
 
   for i := 0; i < n; i++ {
     go func() {
-      for f := range c {
+      for f := range w.c {
+        // drain the remaining jobs once cancelled
+        if ctx.Err() != nil {
+          continue
+        }
+
         if err := f(); err != nil {
-          panic(err)
+          w.fail(err)
         }
       }
 
-      e <- true
+      w.e <- true
     }()
   }
 
-  return &Worker{
-    n: n,
-    c: c,
-    e: e,
-  }
+  return w
+}
+
+func (w *Worker) fail(err error) {
+  w.lck.Lock()
+  defer w.lck.Unlock()
+  w.errs = append(w.errs, err)
+  w.cancel()
+}
+
+// The context for jobs running in this worker. It is done when any job fails
+// or the parent context is done.
+func (w *Worker) Context() context.Context {
+  return w.ctx
 }
 
+// Queue f to run. If the worker has been cancelled, f is dropped.
 func (w *Worker) Do(f func() error) {
-  w.c <- f
+  select {
+  case w.c <- f:
+  case <-w.ctx.Done():
+  }
 }
 
-func (w *Worker) WaitForExit() {
+// Wait for all running jobs to complete and return the first error. If no
+// job failed but the parent context was done, its error is returned.
+func (w *Worker) WaitForExit() error {
   close(w.c)
   for i := 0; i < w.n; i++ {
     <-w.e
   }
+
+  w.lck.Lock()
+  defer w.lck.Unlock()
+
+  err := w.ctx.Err()
+  w.cancel()
+
+  if len(w.errs) > 0 {
+    return w.errs[0]
+  }
+  return err
+}
+
+// All of the errors returned by jobs. This is only complete after
+// WaitForExit has returned.
+func (w *Worker) Errors() []error {
+  w.lck.Lock()
+  defer w.lck.Unlock()
+  return w.errs
 }
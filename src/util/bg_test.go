@@ -0,0 +1,66 @@
+package util
+
+import (
+  "context"
+  "errors"
+  "sync/atomic"
+  "testing"
+)
+
+func TestWorkerRunsAll(t *testing.T) {
+  var n int32
+  w := StartWorker(4)
+  for i := 0; i < 100; i++ {
+    w.Do(func() error {
+      atomic.AddInt32(&n, 1)
+      return nil
+    })
+  }
+
+  if err := w.WaitForExit(); err != nil {
+    t.Fatal(err)
+  }
+
+  if n != 100 {
+    t.Errorf("expected 100 jobs to run, got %d", n)
+  }
+}
+
+func TestWorkerError(t *testing.T) {
+  bad := errors.New("bad")
+
+  var n int32
+  w := StartWorker(1)
+  w.Do(func() error {
+    return bad
+  })
+  for i := 0; i < 100; i++ {
+    w.Do(func() error {
+      atomic.AddInt32(&n, 1)
+      return nil
+    })
+  }
+
+  if err := w.WaitForExit(); err != bad {
+    t.Errorf("expected %v, got %v", bad, err)
+  }
+
+  if n == 100 {
+    t.Errorf("expected remaining jobs to be abandoned")
+  }
+}
+
+func TestWorkerCancel(t *testing.T) {
+  ctx, cancel := context.WithCancel(context.Background())
+  cancel()
+
+  w := StartWorkerWithContext(ctx, 2)
+  w.Do(func() error {
+    t.Errorf("job ran after cancellation")
+    return nil
+  })
+
+  if err := w.WaitForExit(); err != context.Canceled {
+    t.Errorf("expected %v, got %v", context.Canceled, err)
+  }
+}
@@ -1,9 +1,29 @@
 package util
 
-import "time"
+import (
+  "encoding/json"
+  "os"
+  "path/filepath"
+  "time"
+)
 
 func YearInfo(yr int) (time.Time, int) {
   a := time.Date(yr, time.January, 1, 0, 0, 0, 0, time.UTC)
   z := time.Date(yr+1, time.January, 1, 0, 0, 0, 0, time.UTC)
   return a, int(z.Sub(a).Hours() / 24)
 }
+
+// Encode data as JSON into filename, creating its directory if needed.
+func WriteJson(filename string, data interface{}) error {
+  if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+    return err
+  }
+
+  w, err := os.Create(filename)
+  if err != nil {
+    return err
+  }
+  defer w.Close()
+
+  return json.NewEncoder(w).Encode(data)
+}